@@ -2,6 +2,7 @@ package backend
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"log"
 	"net/http"
@@ -30,7 +31,7 @@ type Backend struct {
 	rewriteRunning  bool
 	chWrite         chan *LinePoint
 	chTimer         <-chan time.Time
-	buffers         map[string]*CacheBuffer
+	buffers         map[bufferKey]*CacheBuffer
 	wg              sync.WaitGroup
 }
 
@@ -43,7 +44,7 @@ func NewBackend(cfg *Config, pxcfg *ProxyConfig) (ib *Backend) {
 		rewriteTicker:   time.NewTicker(time.Duration(pxcfg.RewriteInterval) * time.Second),
 		rewriteRunning:  false,
 		chWrite:         make(chan *LinePoint, 16),
-		buffers:         make(map[string]*CacheBuffer),
+		buffers:         make(map[bufferKey]*CacheBuffer),
 	}
 
 	var err error
@@ -92,12 +93,18 @@ func (ib *Backend) WritePoint(point *LinePoint) (err error) {
 	return
 }
 
+// bufferKey is the db and rp of buffered points
+type bufferKey struct {
+	db string
+	rp string
+}
+
 func (ib *Backend) WriteBuffer(point *LinePoint) (err error) {
-	db, line := point.Db, point.Line
-	cb, ok := ib.buffers[db]
+	key, line := bufferKey{point.Db, point.Rp}, point.Line
+	cb, ok := ib.buffers[key]
 	if !ok {
-		ib.buffers[db] = &CacheBuffer{Buffer: &bytes.Buffer{}}
-		cb = ib.buffers[db]
+		ib.buffers[key] = &CacheBuffer{Buffer: &bytes.Buffer{}}
+		cb = ib.buffers[key]
 	}
 
 	atomic.AddUint64(&cb.Counter, 1)
@@ -125,15 +132,15 @@ func (ib *Backend) WriteBuffer(point *LinePoint) (err error) {
 
 	switch {
 	case atomic.LoadUint64(&cb.Counter) >= ib.flushSize:
-		ib.FlushBuffer(db)
+		ib.FlushBuffer(key)
 	case ib.chTimer == nil:
 		ib.chTimer = time.After(time.Duration(ib.flushTime) * time.Second)
 	}
 	return
 }
 
-func (ib *Backend) FlushBuffer(db string) {
-	cb := ib.buffers[db]
+func (ib *Backend) FlushBuffer(key bufferKey) {
+	cb := ib.buffers[key]
 	if cb.Buffer == nil {
 		return
 	}
@@ -157,8 +164,9 @@ func (ib *Backend) FlushBuffer(db string) {
 
 		// p = buf.Bytes()
 
+		db, rp := key.db, key.rp
 		if ib.IsActive() {
-			err := ib.WriteUNCompressed(db, p)
+			err := ib.WriteUNCompressed(db, rp, p)
 			switch err {
 			case nil:
 				return
@@ -173,6 +181,10 @@ func (ib *Backend) FlushBuffer(db string) {
 			}
 		}
 
+		// the data file keeps db only, so the points are rewritten to the default retention policy
+		if rp != "" {
+			log.Printf("write data to file without rp: %s %s, length: %d", db, rp, len(p))
+		}
 		b := bytes.Join([][]byte{[]byte(url.QueryEscape(db)), p}, []byte{' '})
 		err := ib.fb.Write(b)
 		if err != nil {
@@ -183,9 +195,9 @@ func (ib *Backend) FlushBuffer(db string) {
 
 func (ib *Backend) Flush() {
 	ib.chTimer = nil
-	for db := range ib.buffers {
-		if atomic.LoadUint64(&ib.buffers[db].Counter) > 0 {
-			ib.FlushBuffer(db)
+	for key := range ib.buffers {
+		if atomic.LoadUint64(&ib.buffers[key].Counter) > 0 {
+			ib.FlushBuffer(key)
 		}
 	}
 }
@@ -243,7 +255,7 @@ func (ib *Backend) Rewrite() (err error) {
 		return
 	}
 	//此处切换为非压缩写入，压缩有内存泄漏
-	err = ib.WriteUNCompressed(db, p[1])
+	err = ib.WriteUNCompressed(db, "", p[1])
 
 	switch err {
 	case nil:
@@ -310,6 +322,7 @@ func (ib *Backend) GetHealth(ic *Circle) map[string]interface{} {
 	return map[string]interface{}{
 		"name":    ib.Name,
 		"url":     ib.Url,
+		"type":    ib.Type,
 		"active":  ib.IsActive(),
 		"backlog": ib.fb.IsData(),
 		"rewrite": ib.rewriteRunning,
@@ -318,9 +331,25 @@ func (ib *Backend) GetHealth(ic *Circle) map[string]interface{} {
 }
 
 func QueryInParallel(backends []*Backend, req *http.Request, w http.ResponseWriter, decompress bool) (bodies [][]byte, inactive int, err error) {
+	qrs, inactive, err := QueryResultsInParallel(backends, req, w, decompress)
+	if err != nil {
+		return
+	}
+	for _, qr := range qrs {
+		bodies = append(bodies, qr.Body)
+	}
+	return
+}
+
+// QueryResultsInParallel is like QueryInParallel, but the results are labeled with backend names
+func QueryResultsInParallel(backends []*Backend, req *http.Request, w http.ResponseWriter, decompress bool) (qrs []*QueryResult, inactive int, err error) {
 	var wg sync.WaitGroup
 	var header http.Header
 	req.Header.Set("Query-Origin", "Parallel")
+	// cancel the sibling requests once the first error arrives
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	req = req.WithContext(ctx)
 	ch := make(chan *QueryResult, len(backends))
 	for _, be := range backends {
 		if !be.Active {
@@ -331,7 +360,9 @@ func QueryInParallel(backends []*Backend, req *http.Request, w http.ResponseWrit
 		go func(be *Backend) {
 			defer wg.Done()
 			cr := CloneQueryRequest(req)
-			ch <- be.Query(cr, nil, decompress)
+			qr := be.Query(cr, nil, decompress)
+			qr.Backend = be.Name
+			ch <- qr
 		}(be)
 	}
 	go func() {
@@ -344,7 +375,7 @@ func QueryInParallel(backends []*Backend, req *http.Request, w http.ResponseWrit
 			return
 		}
 		header = qr.Header
-		bodies = append(bodies, qr.Body)
+		qrs = append(qrs, qr)
 	}
 	if w != nil {
 		CopyHeader(w.Header(), header)
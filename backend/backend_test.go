@@ -0,0 +1,39 @@
+package backend
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBackendWriteRp(t *testing.T) {
+	writes := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/write" {
+			p, _ := ioutil.ReadAll(r.Body)
+			writes <- r.URL.RawQuery + " " + string(p)
+		}
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	pxcfg := &ProxyConfig{DataDir: t.TempDir(), FlushSize: 1, FlushTime: 1, RewriteInterval: 10, ConnPoolSize: 1, CheckInterval: 1}
+	be := NewBackend(&Config{Name: "b1", Url: server.URL}, pxcfg)
+	defer be.Close()
+	be.WritePoint(&LinePoint{Db: "db", Rp: "weekly", Line: []byte("cpu value=1 1")})
+	be.WritePoint(&LinePoint{Db: "db", Line: []byte("cpu value=2 2")})
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case w := <-writes:
+			got[w] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("writes timeout: %v", got)
+		}
+	}
+	if !got["db=db&rp=weekly cpu value=1 1\n"] || !got["db=db cpu value=2 2\n"] {
+		t.Errorf("writes wrong: %v", got)
+	}
+}
@@ -0,0 +1,193 @@
+package backend
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	StrategyRandom           = "random"
+	StrategyRoundRobin       = "round-robin"
+	StrategyWeighted         = "weighted"
+	StrategyLeastOutstanding = "least-outstanding"
+	StrategyEWMA             = "ewma"
+	StrategyPreferredZone    = "preferred-zone"
+)
+
+var ErrInvalidReadStrategy = errors.New("invalid read_strategy, require random, round-robin, weighted, least-outstanding, ewma or preferred-zone")
+
+// Balancer decides the order of circles to be tried when reading, Peek returns the likely order
+// without changing the state of balancer, which is used by dry run
+type Balancer interface {
+	Order(circles []*Circle) []*Circle
+	Peek(circles []*Circle) []*Circle
+}
+
+func NewBalancer(strategy string, zone string) (Balancer, error) {
+	switch strings.ToLower(strategy) {
+	case "", StrategyRandom:
+		return &RandomBalancer{}, nil
+	case StrategyRoundRobin:
+		return &RoundRobinBalancer{}, nil
+	case StrategyWeighted:
+		return &WeightedBalancer{}, nil
+	case StrategyLeastOutstanding:
+		return &LeastOutstandingBalancer{}, nil
+	case StrategyEWMA:
+		return &EWMABalancer{}, nil
+	case StrategyPreferredZone:
+		return &PreferredZoneBalancer{Zone: zone}, nil
+	default:
+		return nil, ErrInvalidReadStrategy
+	}
+}
+
+func shuffleCircles(circles []*Circle) []*Circle {
+	ordered := make([]*Circle, len(circles))
+	for i, j := range rand.Perm(len(circles)) {
+		ordered[i] = circles[j]
+	}
+	return ordered
+}
+
+func copyCircles(circles []*Circle) []*Circle {
+	ordered := make([]*Circle, len(circles))
+	copy(ordered, circles)
+	return ordered
+}
+
+// RandomBalancer tries circles randomly, it's the default strategy
+type RandomBalancer struct{}
+
+func (rb *RandomBalancer) Order(circles []*Circle) []*Circle {
+	return shuffleCircles(circles)
+}
+
+func (rb *RandomBalancer) Peek(circles []*Circle) []*Circle {
+	return copyCircles(circles)
+}
+
+// RoundRobinBalancer starts from the next circle of last reading
+type RoundRobinBalancer struct {
+	next uint64
+}
+
+func (rb *RoundRobinBalancer) Order(circles []*Circle) []*Circle {
+	n := len(circles)
+	start := int((atomic.AddUint64(&rb.next, 1) - 1) % uint64(n))
+	ordered := make([]*Circle, n)
+	for i := 0; i < n; i++ {
+		ordered[i] = circles[(start+i)%n]
+	}
+	return ordered
+}
+
+func (rb *RoundRobinBalancer) Peek(circles []*Circle) []*Circle {
+	n := len(circles)
+	start := int(atomic.LoadUint64(&rb.next) % uint64(n))
+	ordered := make([]*Circle, n)
+	for i := 0; i < n; i++ {
+		ordered[i] = circles[(start+i)%n]
+	}
+	return ordered
+}
+
+// WeightedBalancer picks circles randomly in proportion to their weights
+type WeightedBalancer struct{}
+
+func (wb *WeightedBalancer) Order(circles []*Circle) []*Circle {
+	rest := make([]*Circle, len(circles))
+	copy(rest, circles)
+	ordered := make([]*Circle, 0, len(circles))
+	for len(rest) > 0 {
+		total := 0
+		for _, c := range rest {
+			total += c.Weight
+		}
+		pick := 0
+		if total > 0 {
+			r := rand.Intn(total)
+			for i, c := range rest {
+				if r < c.Weight {
+					pick = i
+					break
+				}
+				r -= c.Weight
+			}
+		}
+		ordered = append(ordered, rest[pick])
+		rest = append(rest[:pick], rest[pick+1:]...)
+	}
+	return ordered
+}
+
+// Peek orders circles by weight, the heavier the more likely to be picked first
+func (wb *WeightedBalancer) Peek(circles []*Circle) []*Circle {
+	ordered := copyCircles(circles)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Weight > ordered[j].Weight
+	})
+	return ordered
+}
+
+// LeastOutstandingBalancer prefers circles with the fewest running queries
+type LeastOutstandingBalancer struct{}
+
+func (lb *LeastOutstandingBalancer) Order(circles []*Circle) []*Circle {
+	ordered := shuffleCircles(circles)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].GetOutstanding() < ordered[j].GetOutstanding()
+	})
+	return ordered
+}
+
+func (lb *LeastOutstandingBalancer) Peek(circles []*Circle) []*Circle {
+	ordered := copyCircles(circles)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].GetOutstanding() < ordered[j].GetOutstanding()
+	})
+	return ordered
+}
+
+// EWMABalancer prefers circles with the lowest exponentially weighted moving average latency
+type EWMABalancer struct{}
+
+func (eb *EWMABalancer) Order(circles []*Circle) []*Circle {
+	ordered := shuffleCircles(circles)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].GetLatency() < ordered[j].GetLatency()
+	})
+	return ordered
+}
+
+func (eb *EWMABalancer) Peek(circles []*Circle) []*Circle {
+	ordered := copyCircles(circles)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].GetLatency() < ordered[j].GetLatency()
+	})
+	return ordered
+}
+
+// PreferredZoneBalancer tries circles in the same zone as proxy first, and falls back to other circles
+type PreferredZoneBalancer struct {
+	Zone string
+}
+
+func (pb *PreferredZoneBalancer) Order(circles []*Circle) []*Circle {
+	ordered := shuffleCircles(circles)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Zone == pb.Zone && ordered[j].Zone != pb.Zone
+	})
+	return ordered
+}
+
+func (pb *PreferredZoneBalancer) Peek(circles []*Circle) []*Circle {
+	ordered := copyCircles(circles)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Zone == pb.Zone && ordered[j].Zone != pb.Zone
+	})
+	return ordered
+}
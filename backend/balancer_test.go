@@ -0,0 +1,71 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRoundRobinBalancer(t *testing.T) {
+	circles := []*Circle{{CircleId: 0}, {CircleId: 1}, {CircleId: 2}}
+	rb := &RoundRobinBalancer{}
+	for i := 0; i < 6; i++ {
+		ordered := rb.Order(circles)
+		if ordered[0].CircleId != i%3 || ordered[1].CircleId != (i+1)%3 {
+			t.Errorf("round robin order wrong at %d: %d, %d", i, ordered[0].CircleId, ordered[1].CircleId)
+		}
+	}
+}
+
+func TestWeightedBalancer(t *testing.T) {
+	circles := []*Circle{{CircleId: 0, Weight: 1}, {CircleId: 1, Weight: 1000000}}
+	wb := &WeightedBalancer{}
+	ordered := wb.Order(circles)
+	if len(ordered) != 2 || ordered[0].CircleId != 1 {
+		t.Errorf("weighted order wrong: %d", ordered[0].CircleId)
+	}
+}
+
+func TestLeastOutstandingBalancer(t *testing.T) {
+	circles := []*Circle{{CircleId: 0, outstanding: 3}, {CircleId: 1, outstanding: 1}, {CircleId: 2, outstanding: 2}}
+	ordered := (&LeastOutstandingBalancer{}).Order(circles)
+	for i, id := range []int{1, 2, 0} {
+		if ordered[i].CircleId != id {
+			t.Errorf("least outstanding order wrong at %d: %d != %d", i, ordered[i].CircleId, id)
+		}
+	}
+}
+
+func TestEWMABalancer(t *testing.T) {
+	circles := []*Circle{{CircleId: 0}, {CircleId: 1}}
+	circles[0].finishQuery(circles[0].startQuery().Add(-time.Second), true)
+	circles[1].finishQuery(circles[1].startQuery(), true)
+	ordered := (&EWMABalancer{}).Order(circles)
+	if ordered[0].CircleId != 1 {
+		t.Errorf("ewma order wrong: %d", ordered[0].CircleId)
+	}
+	// failed queries don't lower the latency
+	for i := 0; i < 10; i++ {
+		circles[0].finishQuery(circles[0].startQuery(), false)
+	}
+	if ordered = (&EWMABalancer{}).Order(circles); ordered[0].CircleId != 1 || circles[0].GetLatency() < time.Second {
+		t.Errorf("ewma order wrong after failed queries: %d %s", ordered[0].CircleId, circles[0].GetLatency())
+	}
+}
+
+func TestPreferredZoneBalancer(t *testing.T) {
+	circles := []*Circle{{CircleId: 0, Zone: "b"}, {CircleId: 1, Zone: "a"}, {CircleId: 2, Zone: "b"}}
+	pb := &PreferredZoneBalancer{Zone: "a"}
+	for i := 0; i < 10; i++ {
+		ordered := pb.Order(circles)
+		if ordered[0].CircleId != 1 || len(ordered) != 3 {
+			t.Errorf("preferred zone order wrong: %d", ordered[0].CircleId)
+		}
+	}
+}
+
+func TestNewProxyInvalidStrategy(t *testing.T) {
+	ip := NewProxy(&ProxyConfig{ReadStrategy: "fastest"})
+	if _, ok := ip.balancer.(*RandomBalancer); !ok {
+		t.Errorf("invalid read strategy should fall back to random: %T", ip.balancer)
+	}
+}
@@ -0,0 +1,242 @@
+package backend
+
+import (
+	"bytes"
+	"container/list"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/RedTimeDB/RedTimeProxy/util"
+)
+
+var (
+	cacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "redtimeproxy_query_cache_hits_total",
+		Help: "The total number of query cache hits",
+	})
+	cacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "redtimeproxy_query_cache_misses_total",
+		Help: "The total number of query cache misses",
+	})
+)
+
+type cacheEntry struct {
+	key     string
+	measKey string
+	header  http.Header
+	body    []byte
+	expire  time.Time
+}
+
+// cacheMeas tracks the writes of a measurement, gen is increased by every write
+type cacheMeas struct {
+	gen    uint64
+	cached int32
+}
+
+type QueryCache struct {
+	ttl        time.Duration
+	dbTTL      map[string]time.Duration
+	bucket     int64
+	maxEntries int
+
+	lock    sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	index   map[string]map[string]bool
+	meases  sync.Map
+}
+
+func NewQueryCache(cfg *QueryCacheConfig) (qc *QueryCache) {
+	qc = &QueryCache{
+		ttl:        time.Duration(cfg.TTL) * time.Second,
+		dbTTL:      make(map[string]time.Duration, len(cfg.DBTTL)),
+		bucket:     int64(cfg.Bucket),
+		maxEntries: cfg.MaxEntries,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+		index:      make(map[string]map[string]bool),
+	}
+	for db, ttl := range cfg.DBTTL {
+		qc.dbTTL[db] = time.Duration(ttl) * time.Second
+	}
+	return
+}
+
+func (qc *QueryCache) getTTL(db string) time.Duration {
+	if ttl, ok := qc.dbTTL[db]; ok {
+		return ttl
+	}
+	return qc.ttl
+}
+
+// Key returns the cache key of a select query, queries with now() are bucketed by time
+func (qc *QueryCache) Key(req *http.Request, tokens []string, db string) (key string, ok bool) {
+	if qc.getTTL(db) <= 0 || strings.ToLower(tokens[0]) != "select" {
+		return "", false
+	}
+	q := strings.Join(tokens, " ")
+	if strings.Contains(q, ";") {
+		return "", false
+	}
+	var b strings.Builder
+	b.WriteString(db)
+	b.WriteString("|")
+	b.WriteString(req.FormValue("rp"))
+	b.WriteString("|")
+	b.WriteString(req.FormValue("epoch"))
+	b.WriteString("|")
+	b.WriteString(req.FormValue("pretty"))
+	b.WriteString("|")
+	b.WriteString(req.Header.Get("Accept"))
+	b.WriteString("|")
+	b.WriteString(strconv.FormatBool(strings.Contains(req.Header.Get("Accept-Encoding"), "gzip")))
+	b.WriteString("|")
+	if strings.Contains(strings.ToLower(q), "now()") {
+		bucket := time.Now().Unix()
+		if qc.bucket > 0 {
+			bucket /= qc.bucket
+		}
+		b.WriteString(strconv.FormatInt(bucket, 10))
+	}
+	b.WriteString("|")
+	b.WriteString(q)
+	return b.String(), true
+}
+
+func (qc *QueryCache) getMeas(measKey string) *cacheMeas {
+	if cm, ok := qc.meases.Load(measKey); ok {
+		return cm.(*cacheMeas)
+	}
+	cm, _ := qc.meases.LoadOrStore(measKey, &cacheMeas{})
+	return cm.(*cacheMeas)
+}
+
+// Generation returns the write generation of measurement, it should be taken before querying backend
+func (qc *QueryCache) Generation(db, meas string) uint64 {
+	return atomic.LoadUint64(&qc.getMeas(GetKey(db, meas)).gen)
+}
+
+func (qc *QueryCache) Get(key string) (header http.Header, body []byte, ok bool) {
+	qc.lock.Lock()
+	defer qc.lock.Unlock()
+	elem, ok := qc.entries[key]
+	if !ok {
+		cacheMisses.Inc()
+		return
+	}
+	ce := elem.Value.(*cacheEntry)
+	if time.Now().After(ce.expire) {
+		qc.removeElement(elem)
+		cacheMisses.Inc()
+		return nil, nil, false
+	}
+	qc.lru.MoveToFront(elem)
+	cacheHits.Inc()
+	return ce.header, ce.body, true
+}
+
+// Set stores the query result unless the measurement was written since generation gen or any statement failed
+func (qc *QueryCache) Set(key, db, meas string, gen uint64, qr *QueryResult) {
+	if hasStatementError(qr) {
+		return
+	}
+	measKey := GetKey(db, meas)
+	cm := qc.getMeas(measKey)
+	header := http.Header{}
+	for _, k := range []string{"Content-Type", "Content-Encoding"} {
+		if v := qr.Header.Get(k); v != "" {
+			header.Set(k, v)
+		}
+	}
+
+	qc.lock.Lock()
+	defer qc.lock.Unlock()
+	if atomic.LoadUint64(&cm.gen) != gen {
+		return
+	}
+	if elem, ok := qc.entries[key]; ok {
+		qc.removeElement(elem)
+	}
+	ce := &cacheEntry{
+		key:     key,
+		measKey: measKey,
+		header:  header,
+		body:    qr.Body,
+		expire:  time.Now().Add(qc.getTTL(db)),
+	}
+	qc.entries[key] = qc.lru.PushFront(ce)
+	if qc.index[measKey] == nil {
+		qc.index[measKey] = make(map[string]bool)
+	}
+	qc.index[measKey][key] = true
+	atomic.AddInt32(&cm.cached, 1)
+	for qc.maxEntries > 0 && qc.lru.Len() > qc.maxEntries {
+		qc.removeElement(qc.lru.Back())
+	}
+}
+
+// Invalidate removes all cached results of measurement, it's called by every written line
+func (qc *QueryCache) Invalidate(db, meas string) {
+	measKey := GetKey(db, meas)
+	cm := qc.getMeas(measKey)
+	atomic.AddUint64(&cm.gen, 1)
+	if atomic.LoadInt32(&cm.cached) == 0 {
+		return
+	}
+	qc.lock.Lock()
+	defer qc.lock.Unlock()
+	for key := range qc.index[measKey] {
+		qc.removeElement(qc.entries[key])
+	}
+}
+
+func (qc *QueryCache) removeElement(elem *list.Element) {
+	ce := qc.lru.Remove(elem).(*cacheEntry)
+	delete(qc.entries, ce.key)
+	if keys := qc.index[ce.measKey]; keys != nil {
+		delete(keys, ce.key)
+		if len(keys) == 0 {
+			delete(qc.index, ce.measKey)
+		}
+	}
+	atomic.AddInt32(&qc.getMeas(ce.measKey).cached, -1)
+}
+
+// hasStatementError checks the error of statements in result, which is responded with status 200,
+// the result is treated as failed if it can't be decoded
+func hasStatementError(qr *QueryResult) bool {
+	body := qr.Body
+	if qr.Header.Get("Content-Encoding") == "gzip" {
+		var err error
+		if body, err = util.GzipDecompress(body); err != nil {
+			return true
+		}
+	}
+	mt, _, _ := mime.ParseMediaType(qr.Header.Get("Content-Type"))
+	switch mt {
+	case ContentTypeJSON:
+		rsp, err := ResponseFromResponseBytes(body)
+		if err != nil {
+			return true
+		}
+		for _, r := range rsp.Results {
+			if r.Err != "" {
+				return true
+			}
+		}
+		return rsp.Err != ""
+	case ContentTypeMsgPack:
+		// the key "error" of msgpack result as fixstr
+		return bytes.Contains(body, []byte("\xa5error"))
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package backend
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestQueryCache(t *testing.T) {
+	qc := NewQueryCache(&QueryCacheConfig{TTL: 60, DBTTL: map[string]int{"nocache": 0}, MaxEntries: 2, Bucket: 3600})
+	req := NewQueryRequest("GET", "db", "select * from cpu where time > now() - 1h")
+	tokens := ScanTokens(req.FormValue("q"), 0)
+	key, ok := qc.Key(req, tokens, "db")
+	if !ok {
+		t.Fatalf("select should be cacheable")
+	}
+	if key2, _ := qc.Key(req, ScanTokens("select  *   from cpu where time > now() - 1h;", 0), "db"); key2 != key {
+		t.Errorf("normalized key wrong: %s != %s", key2, key)
+	}
+	if _, ok := qc.Key(req, tokens, "nocache"); ok {
+		t.Errorf("db with zero ttl should not be cacheable")
+	}
+	if _, ok := qc.Key(req, ScanTokens("show measurements", 0), "db"); ok {
+		t.Errorf("show should not be cacheable")
+	}
+
+	qr := &QueryResult{Header: http.Header{"Content-Type": []string{"application/json"}}, Status: 200, Body: []byte("{}")}
+	gen := qc.Generation("db", "cpu")
+	qc.Set(key, "db", "cpu", gen, qr)
+	if _, body, ok := qc.Get(key); !ok || string(body) != "{}" {
+		t.Errorf("cache should hit")
+	}
+	qc.Invalidate("db", "mem")
+	if _, _, ok := qc.Get(key); !ok {
+		t.Errorf("cache should hit after writing another measurement")
+	}
+	qc.Invalidate("db", "cpu")
+	if _, _, ok := qc.Get(key); ok {
+		t.Errorf("cache should miss after writing measurement")
+	}
+	qc.Set(key, "db", "cpu", gen, qr)
+	if _, _, ok := qc.Get(key); ok {
+		t.Errorf("cache should not store result of a stale generation")
+	}
+
+	for _, k := range []string{"k1", "k2", "k3"} {
+		qc.Set(k, "db", "cpu", qc.Generation("db", "cpu"), qr)
+	}
+	if _, _, ok := qc.Get("k1"); ok {
+		t.Errorf("least recently used entry should be evicted")
+	}
+	if _, _, ok := qc.Get("k3"); !ok {
+		t.Errorf("cache should hit k3")
+	}
+
+	errQr := &QueryResult{Header: qr.Header, Status: 200, Body: []byte(`{"results":[{"statement_id":0,"error":"shard is closed"}]}`)}
+	qc.Set("k4", "db", "cpu", qc.Generation("db", "cpu"), errQr)
+	if _, _, ok := qc.Get("k4"); ok {
+		t.Errorf("cache should not store result with statement error")
+	}
+}
@@ -1,29 +1,44 @@
 package backend
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/influxdata/influxdb1-client/models"
+	jsoniter "github.com/json-iterator/go"
 	"github.com/RedTimeDB/RedTimeProxy/util"
 	"net/http"
+	"sort"
 	"stathat.com/c/consistent"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ewmaDecay is the weight of the latest latency in the moving average
+const ewmaDecay = 0.2
+
 type Circle struct {
 	CircleId     int // nolint:golint
 	Name         string
+	Zone         string
+	Weight       int
 	Backends     []*Backend
 	WriteOnly    bool
 	router       *consistent.Consistent
 	routerCaches sync.Map
 	mapToBackend map[string]*Backend
+	outstanding  int64
+	latency      float64
+	statLock     sync.Mutex
 }
 
 func NewCircle(cfg *CircleConfig, pxcfg *ProxyConfig, circleId int) (ic *Circle) { // nolint:golint
 	ic = &Circle{
 		CircleId:     circleId,
 		Name:         cfg.Name,
+		Zone:         cfg.Zone,
+		Weight:       cfg.Weight,
 		Backends:     make([]*Backend, len(cfg.Backends)),
 		WriteOnly:    false,
 		router:       consistent.New(),
@@ -103,28 +118,97 @@ func (ic *Circle) CheckActive() bool {
 	return true
 }
 
+// GetOutstanding returns the number of running queries on circle
+func (ic *Circle) GetOutstanding() int64 {
+	return atomic.LoadInt64(&ic.outstanding)
+}
+
+// GetLatency returns the moving average latency of queries on circle
+func (ic *Circle) GetLatency() time.Duration {
+	ic.statLock.Lock()
+	defer ic.statLock.Unlock()
+	return time.Duration(ic.latency)
+}
+
+func (ic *Circle) startQuery() time.Time {
+	atomic.AddInt64(&ic.outstanding, 1)
+	return time.Now()
+}
+
+// finishQuery records the latency of successful query only, so that failing fast doesn't attract more queries
+func (ic *Circle) finishQuery(start time.Time, ok bool) {
+	atomic.AddInt64(&ic.outstanding, -1)
+	if !ok {
+		return
+	}
+	latency := float64(time.Since(start))
+	ic.statLock.Lock()
+	defer ic.statLock.Unlock()
+	if ic.latency == 0 {
+		ic.latency = latency
+	} else {
+		ic.latency = ic.latency*(1-ewmaDecay) + latency*ewmaDecay
+	}
+}
+
+// QueryBackend queries a backend of circle, and records the load and latency of circle
+func (ic *Circle) QueryBackend(be *Backend, req *http.Request, w http.ResponseWriter) (qr *QueryResult) {
+	start := ic.startQuery()
+	defer func() {
+		ic.finishQuery(start, qr != nil && qr.Err == nil && qr.Status < http.StatusInternalServerError)
+	}()
+	recordRoute(req.Context(), ic, be)
+	return be.Query(req, w, false)
+}
+
 func (ic *Circle) Query(w http.ResponseWriter, req *http.Request, tokens []string) (body []byte, err error) {
+	start := ic.startQuery()
+	defer func() {
+		ic.finishQuery(start, err == nil)
+	}()
 	// remove support of query parameter `chunked`
 	req.Form.Del("chunked")
-	bodies, inactive, err := QueryInParallel(ic.Backends, req, w, true)
+	// backends always respond json for merging, the negotiated format is applied after merged
+	contentType := GetContentType(req)
+	req.Header.Set("Accept", ContentTypeJSON)
+	stmt2 := GetHeadStmtFromTokens(tokens, 2)
+	stmt3 := GetHeadStmtFromTokens(tokens, 3)
+	// limit and offset are applied after merged
+	var limit, offset int
+	if stmt3 == "show field keys" || stmt3 == "show tag keys" || stmt3 == "show tag values" {
+		limit, offset = GetLimitOffsetFromTokens(tokens)
+		if limit > 0 || offset > 0 {
+			req.Form.Set("q", RemoveLimitOffset(req.Form.Get("q")))
+		}
+	}
+	recordRoute(req.Context(), ic, ic.Backends...)
+	qrs, inactive, err := QueryResultsInParallel(ic.Backends, req, w, true)
 	if err != nil {
 		return
 	}
-	if inactive > 0 && len(bodies) == 0 {
+	if inactive > 0 && len(qrs) == 0 {
 		return nil, ErrBackendsUnavailable
 	}
+	bodies := make([][]byte, len(qrs))
+	for i, qr := range qrs {
+		bodies[i] = qr.Body
+	}
 
 	var rsp *Response
-	stmt2 := GetHeadStmtFromTokens(tokens, 2)
-	stmt3 := GetHeadStmtFromTokens(tokens, 3)
-	if stmt2 == "show measurements" || stmt2 == "show series" || stmt2 == "show databases" {
+	if cardinality, sum := CheckCardinalityFromTokens(tokens); cardinality {
+		rsp, err = ic.reduceByCardinality(bodies, sum)
+	} else if stmt2 == "show measurements" || stmt2 == "show series" || stmt2 == "show databases" || stmt2 == "show users" {
 		rsp, err = ic.reduceByValues(bodies)
 	} else if stmt3 == "show field keys" || stmt3 == "show tag keys" || stmt3 == "show tag values" {
-		rsp, err = ic.reduceBySeries(bodies)
+		rsp, err = ic.reduceBySeries(bodies, limit, offset)
+	} else if stmt3 == "show continuous queries" {
+		rsp, err = ic.unionBySeries(bodies)
 	} else if stmt3 == "show retention policies" {
 		rsp, err = ic.concatByValues(bodies)
 	} else if stmt2 == "show stats" {
 		rsp, err = ic.concatByResults(bodies)
+	} else if stmt3 == "show shard groups" || stmt2 == "show diagnostics" {
+		rsp, err = ic.concatBySeries(qrs)
 	}
 	if err != nil {
 		return
@@ -135,8 +219,11 @@ func (ic *Circle) Query(w http.ResponseWriter, req *http.Request, tokens []strin
 	if inactive > 0 {
 		rsp.Err = fmt.Sprintf("%d/%d backends unavailable", inactive, inactive+len(bodies))
 	}
+	LimitRows(rsp, maxRowsFromContext(req.Context()))
 	pretty := req.URL.Query().Get("pretty") == "true"
-	body = util.MarshalJSON(rsp, pretty)
+	body = MarshalResponse(rsp, contentType, pretty)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Del("Content-Length")
 	if w.Header().Get("Content-Encoding") == "gzip" {
 		return util.GzipCompress(body)
 	}
@@ -148,7 +235,7 @@ func (ic *Circle) reduceByValues(bodies [][]byte) (rsp *Response, err error) {
 	var values [][]interface{}
 	valuesMap := make(map[string][]interface{})
 	for _, b := range bodies {
-		_series, err := SeriesFromResponseBytes(b)
+		_series, err := SeriesWithNumbers(b)
 		if err != nil {
 			return nil, err
 		}
@@ -173,29 +260,88 @@ func (ic *Circle) reduceByValues(bodies [][]byte) (rsp *Response, err error) {
 	return ResponseFromSeries(series), nil
 }
 
-func (ic *Circle) reduceBySeries(bodies [][]byte) (rsp *Response, err error) {
-	var series models.Rows
-	seriesMap := make(map[string]*models.Row)
-	for _, b := range bodies {
-		_series, err := SeriesFromResponseBytes(b)
-		if err != nil {
-			return nil, err
+// reduceBySeries merges the rows with same name, de-duplicates and sorts the values,
+// reconciles the field types, and applies limit and offset to the values of each row
+func (ic *Circle) reduceBySeries(bodies [][]byte, limit, offset int) (rsp *Response, err error) {
+	rsp, err = ic.unionBySeries(bodies)
+	if err != nil {
+		return
+	}
+	series := rsp.Results[0].Series
+	for _, row := range series {
+		if len(row.Columns) == 2 && row.Columns[0] == "fieldKey" && row.Columns[1] == "fieldType" {
+			row.Values = reconcileFieldTypes(row.Values)
 		}
-		for _, s := range _series {
-			seriesMap[s.Name] = s
+		sort.SliceStable(row.Values, func(i, j int) bool {
+			return lessValues(row.Values[i], row.Values[j])
+		})
+		if offset > 0 {
+			if offset >= len(row.Values) {
+				row.Values = nil
+			} else {
+				row.Values = row.Values[offset:]
+			}
+		}
+		if limit > 0 && limit < len(row.Values) {
+			row.Values = row.Values[:limit]
 		}
 	}
-	for _, item := range seriesMap {
-		series = append(series, item)
+	sort.SliceStable(series, func(i, j int) bool {
+		return series[i].Name < series[j].Name
+	})
+	return
+}
+
+// reconcileFieldTypes keeps one type for each field key, in the precedence of FieldTypes
+func reconcileFieldTypes(values [][]interface{}) [][]interface{} {
+	var fields []string
+	types := make(map[string]util.Set)
+	for _, value := range values {
+		if len(value) < 2 {
+			continue
+		}
+		field, _ := value[0].(string)
+		ft, _ := value[1].(string)
+		if types[field] == nil {
+			types[field] = util.NewSet()
+			fields = append(fields, field)
+		}
+		types[field].Add(ft)
 	}
-	return ResponseFromSeries(series), nil
+	reconciled := make([][]interface{}, 0, len(fields))
+	for _, field := range fields {
+		var ft string
+		for _, dt := range FieldTypes {
+			if types[field][dt] {
+				ft = dt
+				break
+			}
+		}
+		if ft == "" {
+			for dt := range types[field] {
+				ft = dt
+			}
+		}
+		reconciled = append(reconciled, []interface{}{field, ft})
+	}
+	return reconciled
+}
+
+func lessValues(a, b []interface{}) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		x, y := fmt.Sprint(a[i]), fmt.Sprint(b[i])
+		if x != y {
+			return x < y
+		}
+	}
+	return len(a) < len(b)
 }
 
 func (ic *Circle) concatByValues(bodies [][]byte) (rsp *Response, err error) {
 	var series []*models.Row
 	var values [][]interface{}
 	for _, b := range bodies {
-		_series, err := SeriesFromResponseBytes(b)
+		_series, err := SeriesWithNumbers(b)
 		if err != nil {
 			return nil, err
 		}
@@ -213,7 +359,7 @@ func (ic *Circle) concatByValues(bodies [][]byte) (rsp *Response, err error) {
 func (ic *Circle) concatByResults(bodies [][]byte) (rsp *Response, err error) {
 	var results []*Result
 	for _, b := range bodies {
-		_results, err := ResultsFromResponseBytes(b)
+		_results, err := ResultsWithNumbers(b)
 		if err != nil {
 			return nil, err
 		}
@@ -223,3 +369,102 @@ func (ic *Circle) concatByResults(bodies [][]byte) (rsp *Response, err error) {
 	}
 	return ResponseFromResults(results), nil
 }
+
+// reduceByCardinality merges the rows with same name and tags, the values are summed up if sum is true,
+// otherwise the maximum is taken, since the same measurement on different backends are duplicated
+func (ic *Circle) reduceByCardinality(bodies [][]byte, sum bool) (rsp *Response, err error) {
+	var series models.Rows
+	seriesMap := make(map[string]*models.Row)
+	for _, b := range bodies {
+		_series, err := SeriesWithNumbers(b)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range _series {
+			key := string(models.MakeKey([]byte(s.Name), models.NewTags(s.Tags)))
+			row, ok := seriesMap[key]
+			if !ok {
+				seriesMap[key] = s
+				series = append(series, s)
+				continue
+			}
+			for i, value := range s.Values {
+				if i >= len(row.Values) {
+					row.Values = append(row.Values, value)
+					continue
+				}
+				for j, v := range value {
+					n, ok1 := v.(json.Number)
+					m, ok2 := row.Values[i][j].(json.Number)
+					if !ok1 || !ok2 {
+						continue
+					}
+					x, err1 := n.Int64()
+					y, err2 := m.Int64()
+					if err1 != nil || err2 != nil {
+						continue
+					}
+					if sum {
+						row.Values[i][j] = json.Number(strconv.FormatInt(x+y, 10))
+					} else if x > y {
+						row.Values[i][j] = n
+					}
+				}
+			}
+		}
+	}
+	return ResponseFromSeries(series), nil
+}
+
+// unionBySeries merges the rows with same name, and de-duplicates the values
+func (ic *Circle) unionBySeries(bodies [][]byte) (rsp *Response, err error) {
+	var series models.Rows
+	seriesMap := make(map[string]*models.Row)
+	valuesMap := make(map[string]util.Set)
+	for _, b := range bodies {
+		_series, err := SeriesWithNumbers(b)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range _series {
+			row, ok := seriesMap[s.Name]
+			if !ok {
+				row = &models.Row{Name: s.Name, Tags: s.Tags, Columns: s.Columns}
+				seriesMap[s.Name] = row
+				valuesMap[s.Name] = util.NewSet()
+				series = append(series, row)
+			}
+			for _, value := range s.Values {
+				b, _ := jsoniter.Marshal(value)
+				key := string(b)
+				if !valuesMap[s.Name][key] {
+					valuesMap[s.Name].Add(key)
+					row.Values = append(row.Values, value)
+				}
+			}
+		}
+	}
+	return ResponseFromSeries(series), nil
+}
+
+// concatBySeries concatenates the rows of per-node commands, and labels each row with backend name
+func (ic *Circle) concatBySeries(qrs []*QueryResult) (rsp *Response, err error) {
+	var series models.Rows
+	for _, qr := range qrs {
+		_series, err := SeriesWithNumbers(qr.Body)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range _series {
+			if s.Tags == nil {
+				s.Tags = make(map[string]string)
+			}
+			s.Tags["backend"] = qr.Backend
+			series = append(series, s)
+		}
+	}
+	sort.SliceStable(series, func(i, j int) bool {
+		return series[i].Tags["backend"] < series[j].Tags["backend"]
+	})
+	return ResponseFromSeries(series), nil
+}
@@ -0,0 +1,76 @@
+package backend
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestReduceByCardinality(t *testing.T) {
+	bodies := [][]byte{
+		[]byte(`{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["count"],"values":[[3]]},{"name":"mem","columns":["count"],"values":[[2]]}]}]}`),
+		[]byte(`{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["count"],"values":[[4]]}]}]}`),
+	}
+	ic := &Circle{}
+	rsp, err := ic.reduceByCardinality(bodies, true)
+	if err != nil {
+		t.Fatalf("reduce error: %s", err)
+	}
+	series := rsp.Results[0].Series
+	if len(series) != 2 || series[0].Values[0][0] != json.Number("7") || series[1].Values[0][0] != json.Number("2") {
+		t.Errorf("summed cardinality wrong: %v", series)
+	}
+	rsp, _ = ic.reduceByCardinality(bodies, false)
+	if series = rsp.Results[0].Series; series[0].Values[0][0] != json.Number("4") {
+		t.Errorf("de-duplicated cardinality wrong: %v", series)
+	}
+}
+
+func TestConcatBySeries(t *testing.T) {
+	qrs := []*QueryResult{
+		{Backend: "influxdb-2", Body: []byte(`{"results":[{"statement_id":0,"series":[{"name":"shard groups","columns":["id"],"values":[[2]]}]}]}`)},
+		{Backend: "influxdb-1", Body: []byte(`{"results":[{"statement_id":0,"series":[{"name":"shard groups","columns":["id"],"values":[[1]]}]}]}`)},
+	}
+	rsp, err := (&Circle{}).concatBySeries(qrs)
+	if err != nil {
+		t.Fatalf("concat error: %s", err)
+	}
+	series := rsp.Results[0].Series
+	if len(series) != 2 || series[0].Tags["backend"] != "influxdb-1" || series[1].Tags["backend"] != "influxdb-2" {
+		t.Errorf("labeled series wrong: %v", series)
+	}
+}
+
+func TestReduceBySeries(t *testing.T) {
+	bodies := [][]byte{
+		[]byte(`{"results":[{"statement_id":0,"series":[{"name":"mem","columns":["key","value"],"values":[["host","b"]]},{"name":"cpu","columns":["key","value"],"values":[["host","c"],["host","a"]]}]}]}`),
+		[]byte(`{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["key","value"],"values":[["host","b"],["host","a"]]}]}]}`),
+	}
+	ic := &Circle{}
+	rsp, err := ic.reduceBySeries(bodies, 0, 0)
+	if err != nil {
+		t.Fatalf("reduce error: %s", err)
+	}
+	series := rsp.Results[0].Series
+	if len(series) != 2 || series[0].Name != "cpu" || series[1].Name != "mem" {
+		t.Fatalf("merged series wrong: %v", series)
+	}
+	values := series[0].Values
+	if len(values) != 3 || values[0][1] != "a" || values[1][1] != "b" || values[2][1] != "c" {
+		t.Errorf("merged values wrong: %v", values)
+	}
+
+	rsp, _ = ic.reduceBySeries(bodies, 1, 1)
+	if values = rsp.Results[0].Series[0].Values; len(values) != 1 || values[0][1] != "b" {
+		t.Errorf("limit and offset wrong: %v", values)
+	}
+
+	bodies = [][]byte{
+		[]byte(`{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["fieldKey","fieldType"],"values":[["idle","integer"],["user","string"]]}]}]}`),
+		[]byte(`{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["fieldKey","fieldType"],"values":[["idle","float"],["system","integer"]]}]}]}`),
+	}
+	rsp, _ = ic.reduceBySeries(bodies, 0, 0)
+	values = rsp.Results[0].Series[0].Values
+	if len(values) != 3 || values[0][0] != "idle" || values[0][1] != "float" || values[2][0] != "user" {
+		t.Errorf("reconciled field types wrong: %v", values)
+	}
+}
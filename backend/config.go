@@ -6,6 +6,7 @@ import (
 	"gopkg.in/yaml.v2"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/RedTimeDB/RedTimeProxy/util"
@@ -22,6 +23,19 @@ var (
 	ErrEmptyBackendName      = errors.New("backend name cannot be empty")
 	ErrDuplicatedBackendName = errors.New("backend name duplicated")
 	ErrInvalidHashKey        = errors.New("invalid hash_key, require idx, exi, name or url")
+	ErrInvalidBackendType    = errors.New("invalid backend type, require v1 or v2")
+	ErrEmptyBackendOrg       = errors.New("backend org cannot be empty for v2 backend")
+	ErrInvalidProtocol       = errors.New("invalid protocol, require tcp, udp or both")
+	ErrInvalidUDP            = errors.New("udp bind_addr and database cannot be empty")
+	ErrEmptyTopic            = errors.New("mqtt subscription topic cannot be empty")
+	ErrInvalidMQTTFormat     = errors.New("invalid mqtt format, require json or line")
+)
+
+const (
+	// BackendTypeV1 is the backend of influxdb 1.x api
+	BackendTypeV1 = "v1"
+	// BackendTypeV2 is the backend of influxdb 2.x api, writes go to bucket db/rp of org with token
+	BackendTypeV2 = "v2"
 )
 
 type Config struct { // nolint:golint
@@ -30,10 +44,15 @@ type Config struct { // nolint:golint
 	Username   string `json:"username" yaml:"username"`
 	Password   string `json:"password" yaml:"password"`
 	AuthSecure bool   `json:"auth_secure" yaml:"auth_secure"`
+	Type       string `json:"type" yaml:"type"`
+	Org        string `json:"org" yaml:"org"`
+	Token      string `json:"token" yaml:"token"`
 }
 
 type CircleConfig struct {
 	Name     string    `json:"name" yaml:"name"`
+	Zone     string    `json:"zone" yaml:"zone"`
+	Weight   int       `json:"weight" yaml:"weight"`
 	Backends []*Config `json:"backends" yaml:"backends"`
 }
 
@@ -49,37 +68,174 @@ type MQTTConfig struct {
 	ClientID   string `yaml:"client_id"`
 	Db         string `yaml:"db"`
 	Precision  string `yaml:"precision"`
+	// Subscriptions defaults to a subscription of topic_path, qos, db and precision
+	Subscriptions []*MQTTSubscription `yaml:"subscriptions"`
+}
+
+// MQTTSubscription is a topic filter whose messages are written to db, a template like site/+site/device/+id/metric
+// extracts the measurement and tags from topic segments
+type MQTTSubscription struct {
+	Topic           string `yaml:"topic"`
+	QoS             byte   `yaml:"qos"`
+	Template        string `yaml:"template"`
+	Db              string `yaml:"db"`
+	RetentionPolicy string `yaml:"retention_policy"`
+	Precision       string `yaml:"precision"`
+	// Format is json or line, json keys are flattened by separator unless fields are selected by json paths
+	Format     string            `yaml:"format"`
+	Separator  string            `yaml:"separator"`
+	Fields     map[string]string `yaml:"fields"`
+	Tags       map[string]string `yaml:"tags"`
+	TimeKey    string            `yaml:"time_key"`
+	TimeFormat string            `yaml:"time_format"`
+}
+
+type QueryCacheConfig struct {
+	Enable     bool           `json:"enable" yaml:"enable"`
+	TTL        int            `json:"ttl" yaml:"ttl"`
+	DBTTL      map[string]int `json:"db_ttl" yaml:"db_ttl"`
+	MaxEntries int            `json:"max_entries" yaml:"max_entries"`
+	Bucket     int            `json:"bucket" yaml:"bucket"`
+}
+
+type HedgeConfig struct {
+	Enable     bool    `json:"enable" yaml:"enable"`
+	Delay      int     `json:"delay" yaml:"delay"`
+	Percentile float64 `json:"percentile" yaml:"percentile"`
+	Window     int     `json:"window" yaml:"window"`
+}
+
+type PrometheusConfig struct {
+	Database        string `json:"database" yaml:"database"`
+	RetentionPolicy string `json:"retention_policy" yaml:"retention_policy"`
+}
+
+// BucketConfig is the db and rp which a bucket of v2 api is mapped to
+type BucketConfig struct {
+	Database        string `json:"database" yaml:"database"`
+	RetentionPolicy string `json:"retention_policy" yaml:"retention_policy"`
+}
+
+type V2Config struct {
+	Buckets map[string]*BucketConfig `json:"buckets" yaml:"buckets"`
+}
+
+type GraphiteConfig struct {
+	Enable          bool     `json:"enable" yaml:"enable"`
+	BindAddr        string   `json:"bind_addr" yaml:"bind_addr"`
+	Protocol        string   `json:"protocol" yaml:"protocol"`
+	Database        string   `json:"database" yaml:"database"`
+	RetentionPolicy string   `json:"retention_policy" yaml:"retention_policy"`
+	Separator       string   `json:"separator" yaml:"separator"`
+	Tags            []string `json:"tags" yaml:"tags"`
+	Templates       []string `json:"templates" yaml:"templates"`
+}
+
+type OpenTSDBConfig struct {
+	Enable          bool   `json:"enable" yaml:"enable"`
+	BindAddr        string `json:"bind_addr" yaml:"bind_addr"`
+	Database        string `json:"database" yaml:"database"`
+	RetentionPolicy string `json:"retention_policy" yaml:"retention_policy"`
+}
+
+// UDPConfig is a udp listener, like a [[udp]] section of influxdb
+type UDPConfig struct {
+	Enable          bool   `json:"enable" yaml:"enable"`
+	BindAddr        string `json:"bind_addr" yaml:"bind_addr"`
+	Database        string `json:"database" yaml:"database"`
+	RetentionPolicy string `json:"retention_policy" yaml:"retention_policy"`
+	Precision       string `json:"precision" yaml:"precision"`
+	ReadBuffer      int    `json:"read_buffer" yaml:"read_buffer"`
+	MaxDatagramSize int    `json:"max_datagram_size" yaml:"max_datagram_size"`
+	BatchSize       int    `json:"batch_size" yaml:"batch_size"`
+	BatchTimeout    int    `json:"batch_timeout" yaml:"batch_timeout"`
+	QueueSize       int    `json:"queue_size" yaml:"queue_size"`
+	Workers         int    `json:"workers" yaml:"workers"`
+}
+
+type TCPConfig struct {
+	Enable          bool   `json:"enable" yaml:"enable"`
+	BindAddr        string `json:"bind_addr" yaml:"bind_addr"`
+	Database        string `json:"database" yaml:"database"`
+	RetentionPolicy string `json:"retention_policy" yaml:"retention_policy"`
+	Precision       string `json:"precision" yaml:"precision"`
+	TLSEnabled      bool   `json:"tls_enabled" yaml:"tls_enabled"`
+	TLSCert         string `json:"tls_cert" yaml:"tls_cert"`
+	TLSKey          string `json:"tls_key" yaml:"tls_key"`
+	MaxConnections  int    `json:"max_connections" yaml:"max_connections"`
+	IdleTimeout     int    `json:"idle_timeout" yaml:"idle_timeout"`
+	BatchSize       int    `json:"batch_size" yaml:"batch_size"`
+	BatchTimeout    int    `json:"batch_timeout" yaml:"batch_timeout"`
+}
+
+type QueryLogConfig struct {
+	Enable        bool   `json:"enable" yaml:"enable"`
+	Path          string `json:"path" yaml:"path"`
+	SlowThreshold int    `json:"slow_threshold" yaml:"slow_threshold"`
+	MaxSize       int    `json:"max_size" yaml:"max_size"`
+	MaxBackups    int    `json:"max_backups" yaml:"max_backups"`
+	MaxAge        int    `json:"max_age" yaml:"max_age"`
+}
+
+// GuardPolicy limits the select queries of a database, zero means no limit
+type GuardPolicy struct {
+	RequireTimeBound    bool `json:"require_time_bound" yaml:"require_time_bound"`
+	MaxRange            int  `json:"max_range" yaml:"max_range"`
+	MaxLimit            int  `json:"max_limit" yaml:"max_limit"`
+	MaxSLimit           int  `json:"max_slimit" yaml:"max_slimit"`
+	MaxRegexCardinality int  `json:"max_regex_cardinality" yaml:"max_regex_cardinality"`
+	MaxRows             int  `json:"max_rows" yaml:"max_rows"`
+}
+
+type QueryGuardConfig struct {
+	Enable      bool `json:"enable" yaml:"enable"`
+	GuardPolicy `yaml:",inline"`
+	DBGuard     map[string]*GuardPolicy `json:"db_guard" yaml:"db_guard"`
 }
 
 type ProxyConfig struct {
-	Circles         []*CircleConfig `json:"circles" yaml:"circles"`
-	ListenAddr      string          `json:"listen_addr" yaml:"listen_addr"`
-	DBList          []string        `json:"db_list" yaml:"db_list"`
-	DataDir         string          `json:"data_dir" yaml:"data_dir"`
-	TLogDir         string          `json:"tlog_dir" yaml:"tlog_dir"`
-	HashKey         string          `json:"hash_key" yaml:"hash_key"`
-	FlushSize       uint64          `json:"flush_size" yaml:"flush_size"`
-	FlushTime       int             `json:"flush_time" yaml:"flush_time"`
-	CheckInterval   int             `json:"check_interval" yaml:"check_interval"`
-	RewriteInterval int             `json:"rewrite_interval" yaml:"rewrite_interval"`
-	ConnPoolSize    int             `json:"conn_pool_size" yaml:"conn_pool_size"`
-	WriteTimeout    int             `json:"write_timeout" yaml:"write_timeout"`
-	IdleTimeout     int             `json:"idle_timeout" yaml:"idle_timeout"`
-	Username        string          `json:"username" yaml:"username"`
-	Password        string          `json:"password" yaml:"password"`
-	AuthSecure      bool            `json:"auth_secure" yaml:"auth_secure"`
-	WriteTracing    bool            `json:"write_tracing" yaml:"write_tracing"`
-	QueryTracing    bool            `json:"query_tracing" yaml:"query_tracing"`
-	HTTPSEnabled    bool            `json:"https_enabled" yaml:"https_enabled"`
-	HTTPSCert       string          `json:"https_cert" yaml:"https_cert"`
-	HTTPSKey        string          `json:"https_key" yaml:"https_key"`
-	UDPEnable       bool            `json:"udp_enable" yaml:"udp_enable"`
-	UDPBind         string          `json:"udp_bind" yaml:"udp_bind"`
-	UDPDataBase     string          `json:"udp_database" yaml:"udp_database"`
-	UDPPoolSize     int             `json:"udp_pool_size" yaml:"udp_pool_size"`
-	UDPPrecision    string          `json:"udp_precision" yaml:"udp_precision"`
-	MQTTEnable      bool            `yaml:"mqtt_enable"`
-	MQTT            *MQTTConfig     `json:"mqtt" yaml:"mqtt"`
+	Circles         []*CircleConfig   `json:"circles" yaml:"circles"`
+	ListenAddr      string            `json:"listen_addr" yaml:"listen_addr"`
+	DBList          []string          `json:"db_list" yaml:"db_list"`
+	DataDir         string            `json:"data_dir" yaml:"data_dir"`
+	TLogDir         string            `json:"tlog_dir" yaml:"tlog_dir"`
+	HashKey         string            `json:"hash_key" yaml:"hash_key"`
+	FlushSize       uint64            `json:"flush_size" yaml:"flush_size"`
+	FlushTime       int               `json:"flush_time" yaml:"flush_time"`
+	CheckInterval   int               `json:"check_interval" yaml:"check_interval"`
+	RewriteInterval int               `json:"rewrite_interval" yaml:"rewrite_interval"`
+	ConnPoolSize    int               `json:"conn_pool_size" yaml:"conn_pool_size"`
+	WriteTimeout    int               `json:"write_timeout" yaml:"write_timeout"`
+	IdleTimeout     int               `json:"idle_timeout" yaml:"idle_timeout"`
+	QueryTimeout    int               `json:"query_timeout" yaml:"query_timeout"`
+	DBQueryTimeout  map[string]int    `json:"db_query_timeout" yaml:"db_query_timeout"`
+	ReadStrategy    string            `json:"read_strategy" yaml:"read_strategy"`
+	Zone            string            `json:"zone" yaml:"zone"`
+	Username        string            `json:"username" yaml:"username"`
+	Password        string            `json:"password" yaml:"password"`
+	AuthSecure      bool              `json:"auth_secure" yaml:"auth_secure"`
+	WriteTracing    bool              `json:"write_tracing" yaml:"write_tracing"`
+	QueryTracing    bool              `json:"query_tracing" yaml:"query_tracing"`
+	HTTPSEnabled    bool              `json:"https_enabled" yaml:"https_enabled"`
+	HTTPSCert       string            `json:"https_cert" yaml:"https_cert"`
+	HTTPSKey        string            `json:"https_key" yaml:"https_key"`
+	UDPEnable       bool              `json:"udp_enable" yaml:"udp_enable"`
+	UDPBind         string            `json:"udp_bind" yaml:"udp_bind"`
+	UDPDataBase     string            `json:"udp_database" yaml:"udp_database"`
+	UDPPoolSize     int               `json:"udp_pool_size" yaml:"udp_pool_size"`
+	UDPPrecision    string            `json:"udp_precision" yaml:"udp_precision"`
+	MQTTEnable      bool              `yaml:"mqtt_enable"`
+	MQTT            *MQTTConfig       `json:"mqtt" yaml:"mqtt"`
+	QueryCache      *QueryCacheConfig `json:"query_cache" yaml:"query_cache"`
+	Hedge           *HedgeConfig      `json:"hedge" yaml:"hedge"`
+	QueryGuard      *QueryGuardConfig `json:"query_guard" yaml:"query_guard"`
+	QueryLog        *QueryLogConfig   `json:"query_log" yaml:"query_log"`
+	Prometheus      *PrometheusConfig `json:"prometheus" yaml:"prometheus"`
+	V2              *V2Config         `json:"v2" yaml:"v2"`
+	Graphite        *GraphiteConfig   `json:"graphite" yaml:"graphite"`
+	OpenTSDB        *OpenTSDBConfig   `json:"opentsdb" yaml:"opentsdb"`
+	TCP             *TCPConfig        `json:"tcp" yaml:"tcp"`
+	UDP             []*UDPConfig      `json:"udp" yaml:"udp"`
 }
 
 // NewFileConfig is create a config from file
@@ -125,6 +281,13 @@ func NewConfigYaml(cfgfile string) (cfg *ProxyConfig, err error) {
 }
 
 func (cfg *ProxyConfig) setDefault() {
+	for _, circle := range cfg.Circles {
+		for _, backend := range circle.Backends {
+			if backend.Type == "" {
+				backend.Type = BackendTypeV1
+			}
+		}
+	}
 	if cfg.ListenAddr == "" {
 		cfg.ListenAddr = ":80"
 	}
@@ -158,6 +321,139 @@ func (cfg *ProxyConfig) setDefault() {
 	if cfg.IdleTimeout <= 0 {
 		cfg.IdleTimeout = 10
 	}
+	if cfg.ReadStrategy == "" {
+		cfg.ReadStrategy = StrategyRandom
+	}
+	for _, circle := range cfg.Circles {
+		if circle.Weight <= 0 {
+			circle.Weight = 1
+		}
+	}
+	if cfg.QueryCache != nil {
+		if cfg.QueryCache.TTL <= 0 {
+			cfg.QueryCache.TTL = 60
+		}
+		if cfg.QueryCache.MaxEntries <= 0 {
+			cfg.QueryCache.MaxEntries = 10000
+		}
+		if cfg.QueryCache.Bucket <= 0 {
+			cfg.QueryCache.Bucket = 10
+		}
+	}
+	if cfg.Hedge != nil {
+		if cfg.Hedge.Delay <= 0 {
+			cfg.Hedge.Delay = 100
+		}
+		if cfg.Hedge.Window < minHedgeSamples {
+			cfg.Hedge.Window = 1000
+		}
+	}
+	if cfg.QueryLog != nil {
+		if cfg.QueryLog.Path == "" {
+			cfg.QueryLog.Path = filepath.Join(cfg.TLogDir, "query.log")
+		}
+		if cfg.QueryLog.MaxSize <= 0 {
+			cfg.QueryLog.MaxSize = 100
+		}
+		if cfg.QueryLog.MaxBackups <= 0 {
+			cfg.QueryLog.MaxBackups = 5
+		}
+		if cfg.QueryLog.MaxAge <= 0 {
+			cfg.QueryLog.MaxAge = 7
+		}
+	}
+	if cfg.Graphite != nil {
+		if cfg.Graphite.BindAddr == "" {
+			cfg.Graphite.BindAddr = ":2003"
+		}
+		if cfg.Graphite.Protocol == "" {
+			cfg.Graphite.Protocol = "tcp"
+		}
+		if cfg.Graphite.Database == "" {
+			cfg.Graphite.Database = "graphite"
+		}
+		if cfg.Graphite.Separator == "" {
+			cfg.Graphite.Separator = "."
+		}
+	}
+	if cfg.OpenTSDB != nil {
+		if cfg.OpenTSDB.BindAddr == "" {
+			cfg.OpenTSDB.BindAddr = ":4242"
+		}
+		if cfg.OpenTSDB.Database == "" {
+			cfg.OpenTSDB.Database = "opentsdb"
+		}
+	}
+	if cfg.UDPEnable && cfg.UDPBind != "" {
+		// the legacy udp_* options are the first listener
+		cfg.UDP = append([]*UDPConfig{{Enable: true, BindAddr: cfg.UDPBind, Database: cfg.UDPDataBase, Precision: cfg.UDPPrecision, Workers: cfg.UDPPoolSize}}, cfg.UDP...)
+	}
+	if cfg.MQTT != nil {
+		if len(cfg.MQTT.Subscriptions) == 0 {
+			topic := cfg.MQTT.TopicPath
+			if topic == "" {
+				topic = "#"
+			}
+			cfg.MQTT.Subscriptions = []*MQTTSubscription{{Topic: topic, QoS: cfg.MQTT.QoS}}
+		}
+		for _, sub := range cfg.MQTT.Subscriptions {
+			if sub.Db == "" {
+				sub.Db = cfg.MQTT.Db
+			}
+			if sub.Precision == "" {
+				sub.Precision = cfg.MQTT.Precision
+			}
+			if sub.Precision == "" {
+				sub.Precision = "ns"
+			}
+			if sub.Format == "" {
+				sub.Format = MQTTFormatJSON
+			}
+			if sub.Separator == "" {
+				sub.Separator = "_"
+			}
+			if sub.TimeFormat == "" {
+				sub.TimeFormat = "unix"
+			}
+		}
+	}
+	for _, udp := range cfg.UDP {
+		if udp.Precision == "" {
+			udp.Precision = "ns"
+		}
+		if udp.MaxDatagramSize <= 0 {
+			udp.MaxDatagramSize = 65536
+		}
+		if udp.BatchSize <= 0 {
+			udp.BatchSize = 5000
+		}
+		if udp.BatchTimeout <= 0 {
+			udp.BatchTimeout = 1000
+		}
+		if udp.QueueSize <= 0 {
+			udp.QueueSize = 1000
+		}
+		if udp.Workers <= 0 {
+			udp.Workers = 4
+		}
+	}
+	if cfg.TCP != nil {
+		if cfg.TCP.BindAddr == "" {
+			cfg.TCP.BindAddr = ":8094"
+		}
+		if cfg.TCP.Precision == "" {
+			cfg.TCP.Precision = "ns"
+		}
+		if cfg.TCP.IdleTimeout <= 0 {
+			cfg.TCP.IdleTimeout = 300
+		}
+		if cfg.TCP.BatchSize <= 0 {
+			cfg.TCP.BatchSize = 5000
+		}
+		if cfg.TCP.BatchTimeout <= 0 {
+			cfg.TCP.BatchTimeout = 1000
+		}
+	}
 }
 
 func (cfg *ProxyConfig) checkConfig() (err error) {
@@ -177,6 +473,12 @@ func (cfg *ProxyConfig) checkConfig() (err error) {
 				return ErrDuplicatedBackendName
 			}
 			set.Add(backend.Name)
+			if backend.Type != BackendTypeV1 && backend.Type != BackendTypeV2 {
+				return ErrInvalidBackendType
+			}
+			if backend.Type == BackendTypeV2 && backend.Org == "" {
+				return ErrEmptyBackendOrg
+			}
 		}
 	}
 
@@ -189,6 +491,50 @@ func (cfg *ProxyConfig) checkConfig() (err error) {
 		return ErrInvalidHashKey
 	}
 
+	_, err = NewBalancer(cfg.ReadStrategy, cfg.Zone)
+	if err != nil {
+		return
+	}
+
+	if cfg.Graphite != nil && cfg.Graphite.Enable {
+		switch cfg.Graphite.Protocol {
+		case "tcp", "udp", "both":
+		default:
+			return ErrInvalidProtocol
+		}
+		_, err = NewGraphiteParser(cfg.Graphite.Separator, cfg.Graphite.Templates, cfg.Graphite.Tags)
+		if err != nil {
+			return
+		}
+	}
+	if cfg.TCP != nil && cfg.TCP.Enable && !precisions[cfg.TCP.Precision] {
+		return ErrInvalidPrecision
+	}
+	if cfg.MQTTEnable && cfg.MQTT != nil {
+		for _, sub := range cfg.MQTT.Subscriptions {
+			if sub.Topic == "" {
+				return ErrEmptyTopic
+			}
+			if !precisions[sub.Precision] {
+				return ErrInvalidPrecision
+			}
+			if sub.Format != MQTTFormatJSON && sub.Format != MQTTFormatLine {
+				return ErrInvalidMQTTFormat
+			}
+		}
+	}
+	for _, udp := range cfg.UDP {
+		if !udp.Enable {
+			continue
+		}
+		if udp.BindAddr == "" || udp.Database == "" {
+			return ErrInvalidUDP
+		}
+		if !precisions[udp.Precision] {
+			return ErrInvalidPrecision
+		}
+	}
+
 	return
 }
 
@@ -199,7 +545,42 @@ func (cfg *ProxyConfig) PrintSummary() {
 		log.Printf("circle %d: %d backends loaded", id, len(circle.Backends))
 	}
 	log.Printf("hash key: %s", cfg.HashKey)
+	log.Printf("read strategy: %s", cfg.ReadStrategy)
 	if len(cfg.DBList) > 0 {
 		log.Printf("db list: %v", cfg.DBList)
 	}
+	if cfg.QueryCache != nil && cfg.QueryCache.Enable {
+		log.Printf("query cache: ttl %ds, max entries %d, bucket %ds", cfg.QueryCache.TTL, cfg.QueryCache.MaxEntries, cfg.QueryCache.Bucket)
+	}
+	if cfg.Hedge != nil && cfg.Hedge.Enable {
+		log.Printf("hedge: delay %dms, percentile %v", cfg.Hedge.Delay, cfg.Hedge.Percentile)
+	}
+	if cfg.QueryGuard != nil && cfg.QueryGuard.Enable {
+		log.Printf("query guard: %d database policies", len(cfg.QueryGuard.DBGuard))
+	}
+	if cfg.QueryLog != nil && cfg.QueryLog.Enable {
+		log.Printf("query log: %s, slow threshold %dms", cfg.QueryLog.Path, cfg.QueryLog.SlowThreshold)
+	}
+	if cfg.V2 != nil && len(cfg.V2.Buckets) > 0 {
+		log.Printf("v2 api: %d bucket mappings", len(cfg.V2.Buckets))
+	}
+	if cfg.Graphite != nil && cfg.Graphite.Enable {
+		log.Printf("graphite: %s %s, db %s, %d templates", cfg.Graphite.Protocol, cfg.Graphite.BindAddr, cfg.Graphite.Database, len(cfg.Graphite.Templates))
+	}
+	if cfg.OpenTSDB != nil && cfg.OpenTSDB.Enable {
+		log.Printf("opentsdb: %s, db %s", cfg.OpenTSDB.BindAddr, cfg.OpenTSDB.Database)
+	}
+	for _, udp := range cfg.UDP {
+		if udp.Enable {
+			log.Printf("udp: %s, db %s, precision %s, batch %d", udp.BindAddr, udp.Database, udp.Precision, udp.BatchSize)
+		}
+	}
+	if cfg.MQTTEnable && cfg.MQTT != nil {
+		for _, sub := range cfg.MQTT.Subscriptions {
+			log.Printf("mqtt: %s qos %d, format %s, template %q, db %s, precision %s", sub.Topic, sub.QoS, sub.Format, sub.Template, sub.Db, sub.Precision)
+		}
+	}
+	if cfg.TCP != nil && cfg.TCP.Enable {
+		log.Printf("tcp: %s, db %s, tls %t, max connections %d", cfg.TCP.BindAddr, cfg.TCP.Database, cfg.TCP.TLSEnabled, cfg.TCP.MaxConnections)
+	}
 }
@@ -0,0 +1,64 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUDPConfig(t *testing.T) {
+	cfg := &ProxyConfig{
+		Circles:     []*CircleConfig{{Backends: []*Config{{Name: "b1", Url: "http://127.0.0.1:8086"}}}},
+		UDPEnable:   true,
+		UDPBind:     ":8089",
+		UDPDataBase: "udp",
+		UDP:         []*UDPConfig{{Enable: true, BindAddr: ":8090", Database: "sensors", Precision: "s", BatchSize: 100}},
+	}
+	cfg.setDefault()
+	if err := cfg.checkConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.UDP) != 2 || *cfg.UDP[0] != (UDPConfig{Enable: true, BindAddr: ":8089", Database: "udp", Precision: "ns", MaxDatagramSize: 65536, BatchSize: 5000, BatchTimeout: 1000, QueueSize: 1000, Workers: 4}) {
+		t.Errorf("legacy udp listener wrong: %+v", cfg.UDP[0])
+	}
+	if udp := cfg.UDP[1]; udp.Precision != "s" || udp.BatchSize != 100 || udp.BatchTimeout != 1000 {
+		t.Errorf("udp listener wrong: %+v", udp)
+	}
+
+	cfg.UDP = append(cfg.UDP, &UDPConfig{Enable: true, BindAddr: ":8091"})
+	if err := cfg.checkConfig(); err != ErrInvalidUDP {
+		t.Errorf("udp listener without database should be invalid: %v", err)
+	}
+	cfg.UDP[2] = &UDPConfig{Enable: true, BindAddr: ":8091", Database: "db", Precision: "us"}
+	if err := cfg.checkConfig(); err != ErrInvalidPrecision {
+		t.Errorf("udp listener of precision us should be invalid: %v", err)
+	}
+}
+
+func TestMQTTConfig(t *testing.T) {
+	cfg := &ProxyConfig{
+		Circles:    []*CircleConfig{{Backends: []*Config{{Name: "b1", Url: "http://127.0.0.1:8086"}}}},
+		MQTTEnable: true,
+		MQTT:       &MQTTConfig{TopicPath: "sensors/#", QoS: 1, Db: "mqtt", Precision: "s"},
+	}
+	cfg.setDefault()
+	if err := cfg.checkConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.MQTT.Subscriptions) != 1 || !reflect.DeepEqual(*cfg.MQTT.Subscriptions[0], MQTTSubscription{Topic: "sensors/#", QoS: 1, Db: "mqtt", Precision: "s", Format: "json", Separator: "_", TimeFormat: "unix"}) {
+		t.Errorf("legacy mqtt subscription wrong: %+v", cfg.MQTT.Subscriptions)
+	}
+
+	cfg.MQTT = &MQTTConfig{Db: "mqtt", Subscriptions: []*MQTTSubscription{{Topic: "plant/#", Template: "plant/+plant/line/+line/measurement"}, {Db: "other"}}}
+	cfg.setDefault()
+	if sub := cfg.MQTT.Subscriptions[0]; sub.Db != "mqtt" || sub.Precision != "ns" {
+		t.Errorf("mqtt subscription wrong: %+v", sub)
+	}
+	if err := cfg.checkConfig(); err != ErrEmptyTopic {
+		t.Errorf("mqtt subscription without topic should be invalid: %v", err)
+	}
+	cfg.MQTT.Subscriptions[1].Topic = "other/#"
+	cfg.MQTT.Subscriptions[1].Format = "csv"
+	if err := cfg.checkConfig(); err != ErrInvalidMQTTFormat {
+		t.Errorf("mqtt subscription of format csv should be invalid: %v", err)
+	}
+}
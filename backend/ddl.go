@@ -0,0 +1,295 @@
+package backend
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RedTimeDB/RedTimeProxy/util"
+)
+
+// BroadcastCmds are the administrative statements which are sent to all backends
+var BroadcastCmds = util.NewSet(
+	"create retention policy",
+	"alter retention policy",
+	"drop retention policy",
+	"create continuous query",
+	"drop continuous query",
+	"create user",
+	"drop user",
+	"set password",
+	"grant",
+	"revoke",
+)
+
+// ReconcileAction is a statement applied to a backend by reconciling
+type ReconcileAction struct {
+	Backend   string `json:"backend"`
+	Db        string `json:"db"`
+	Statement string `json:"statement"`
+	Err       string `json:"error,omitempty"`
+}
+
+type retentionPolicy struct {
+	name          string
+	duration      string
+	shardDuration string
+	replication   int
+	isDefault     bool
+}
+
+func CheckBroadcastFromTokens(tokens []string) bool {
+	for n := 1; n <= 3 && n <= len(tokens); n++ {
+		if BroadcastCmds[GetHeadStmtFromTokens(tokens, n)] {
+			return true
+		}
+	}
+	return false
+}
+
+// statementError returns the error of response body, including the errors of statements
+func statementError(body []byte) error {
+	rsp, err := ResponseFromResponseBytes(body)
+	if err != nil {
+		return err
+	}
+	if rsp.Err != "" {
+		return fmt.Errorf("%s", rsp.Err)
+	}
+	for _, r := range rsp.Results {
+		if r.Err != "" {
+			return fmt.Errorf("%s", r.Err)
+		}
+	}
+	return nil
+}
+
+func (ip *Proxy) allBackends() []*Backend {
+	backends := make([]*Backend, 0)
+	for _, circle := range ip.Circles {
+		backends = append(backends, circle.Backends...)
+	}
+	return backends
+}
+
+// broadcastQuery sends the query to all backends of all circles, it succeeds only if all backends succeed,
+// otherwise the failed backends are reported
+func (ip *Proxy) broadcastQuery(req *http.Request, w http.ResponseWriter) (body []byte, err error) {
+	for _, circle := range ip.Circles {
+		if !circle.CheckActive() {
+			return nil, fmt.Errorf("circle %d unavailable", circle.CircleId)
+		}
+	}
+	backends := ip.allBackends()
+	recordRoute(req.Context(), nil, backends...)
+	qrs := make([]*QueryResult, len(backends))
+	var wg sync.WaitGroup
+	for i, be := range backends {
+		wg.Add(1)
+		go func(i int, be *Backend) {
+			defer wg.Done()
+			qrs[i] = be.Query(CloneQueryRequest(req), nil, true)
+			if qrs[i].Err == nil {
+				qrs[i].Err = statementError(qrs[i].Body)
+			}
+		}(i, be)
+	}
+	wg.Wait()
+
+	var failures []string
+	for i, qr := range qrs {
+		if qr.Err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", backends[i].Name, qr.Err))
+		}
+	}
+	if len(failures) > 0 {
+		return nil, fmt.Errorf("%d/%d backends failed, %s", len(failures), len(backends), strings.Join(failures, "; "))
+	}
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	return qrs[0].Body, nil
+}
+
+// Reconcile re-applies the databases, retention policies and continuous queries existing on any backend
+// to the target backends which are missing them, all backends are targets if backendUrls is empty
+func (ip *Proxy) Reconcile(dbs []string, backendUrls []string) (actions []*ReconcileAction, err error) {
+	var sources []*Backend
+	for _, be := range ip.allBackends() {
+		if be.IsActive() {
+			sources = append(sources, be)
+		}
+	}
+	if len(sources) == 0 {
+		return nil, ErrBackendsUnavailable
+	}
+	urlSet := util.NewSetFromSlice(backendUrls)
+	var targets []*Backend
+	for _, be := range sources {
+		if len(urlSet) == 0 || urlSet[be.Url] {
+			targets = append(targets, be)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, ErrGetBackends
+	}
+
+	if len(dbs) == 0 {
+		dbSet := util.NewSet()
+		for _, be := range sources {
+			for _, db := range be.GetDatabases() {
+				if !dbSet[db] {
+					dbSet.Add(db)
+					dbs = append(dbs, db)
+				}
+			}
+		}
+	}
+
+	cqs := make(map[string]map[string]string)
+	for _, be := range sources {
+		for db, queries := range be.GetContinuousQueries() {
+			if cqs[db] == nil {
+				cqs[db] = make(map[string]string)
+			}
+			for name, q := range queries {
+				if _, ok := cqs[db][name]; !ok {
+					cqs[db][name] = q
+				}
+			}
+		}
+	}
+
+	for _, db := range dbs {
+		var rps []*retentionPolicy
+		rpSet := util.NewSet()
+		for _, be := range sources {
+			for _, rp := range be.getRetentionPolicies(db) {
+				if !rpSet[rp.name] {
+					rpSet.Add(rp.name)
+					rps = append(rps, rp)
+				}
+			}
+		}
+		for _, be := range targets {
+			actions = append(actions, be.reconcileDatabase(db, rps, cqs[db])...)
+		}
+	}
+	return actions, nil
+}
+
+func (be *Backend) reconcileDatabase(db string, rps []*retentionPolicy, cqs map[string]string) (actions []*ReconcileAction) {
+	apply := func(q string) {
+		action := &ReconcileAction{Backend: be.Name, Db: db, Statement: q}
+		body, err := be.QueryIQL("POST", db, q)
+		if err == nil {
+			err = statementError(body)
+		}
+		if err != nil {
+			action.Err = err.Error()
+		}
+		actions = append(actions, action)
+	}
+
+	if !util.NewSetFromSlice(be.GetDatabases())[db] {
+		apply(fmt.Sprintf("create database \"%s\"", util.EscapeIdentifier(db)))
+	}
+	existing := util.NewSet()
+	for _, rp := range be.getRetentionPolicies(db) {
+		existing.Add(rp.name)
+	}
+	for _, rp := range rps {
+		if !existing[rp.name] {
+			apply(rp.createStatement(db))
+		}
+	}
+	existing = util.NewSet()
+	for name := range be.GetContinuousQueries()[db] {
+		existing.Add(name)
+	}
+	for name, q := range cqs {
+		if !existing[name] {
+			apply(q)
+		}
+	}
+	return
+}
+
+func (hb *HttpBackend) getRetentionPolicies(db string) (rps []*retentionPolicy) {
+	q := fmt.Sprintf("show retention policies on \"%s\"", util.EscapeIdentifier(db))
+	qr := hb.Query(NewQueryRequest("GET", db, q), nil, true)
+	if qr.Err != nil {
+		return
+	}
+	series, _ := SeriesFromResponseBytes(qr.Body)
+	for _, s := range series {
+		idx := make(map[string]int, len(s.Columns))
+		for i, c := range s.Columns {
+			idx[c] = i
+		}
+		for _, v := range s.Values {
+			rp := &retentionPolicy{}
+			rp.name, _ = v[idx["name"]].(string)
+			rp.duration, _ = v[idx["duration"]].(string)
+			rp.shardDuration, _ = v[idx["shardGroupDuration"]].(string)
+			if n, ok := v[idx["replicaN"]].(float64); ok {
+				rp.replication = int(n)
+			}
+			rp.isDefault, _ = v[idx["default"]].(bool)
+			rps = append(rps, rp)
+		}
+	}
+	return
+}
+
+// GetContinuousQueries returns the continuous queries by database and name
+func (hb *HttpBackend) GetContinuousQueries() map[string]map[string]string {
+	cqs := make(map[string]map[string]string)
+	qr := hb.Query(NewQueryRequest("GET", "", "show continuous queries"), nil, true)
+	if qr.Err != nil {
+		return cqs
+	}
+	series, _ := SeriesFromResponseBytes(qr.Body)
+	for _, s := range series {
+		cqs[s.Name] = make(map[string]string)
+		for _, v := range s.Values {
+			if len(v) >= 2 {
+				name, _ := v[0].(string)
+				q, _ := v[1].(string)
+				cqs[s.Name][name] = q
+			}
+		}
+	}
+	return cqs
+}
+
+func (rp *retentionPolicy) createStatement(db string) string {
+	q := fmt.Sprintf("create retention policy \"%s\" on \"%s\" duration %s replication %d", util.EscapeIdentifier(rp.name), util.EscapeIdentifier(db), formatDuration(rp.duration), rp.replication)
+	if sd := formatDuration(rp.shardDuration); sd != "INF" {
+		q += " shard duration " + sd
+	}
+	if rp.isDefault {
+		q += " default"
+	}
+	return q
+}
+
+// formatDuration converts the duration like 168h0m0s to an InfluxQL duration literal
+func formatDuration(s string) string {
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return "INF"
+	}
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	default:
+		return fmt.Sprintf("%dms", d/time.Millisecond)
+	}
+}
@@ -0,0 +1,68 @@
+package backend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckBroadcastFromTokens(t *testing.T) {
+	for _, q := range []string{
+		"CREATE RETENTION POLICY \"10m.events\" ON \"somedb\" DURATION 60m REPLICATION 2",
+		"ALTER RETENTION POLICY \"1h.cpu\" ON \"mydb\" DEFAULT",
+		"DROP RETENTION POLICY \"1h.cpu\" ON \"mydb\"",
+		"CREATE CONTINUOUS QUERY \"cq\" ON \"mydb\" BEGIN SELECT mean(\"value\") INTO \"cpu_1h\" FROM \"cpu\" GROUP BY time(1h) END",
+		"DROP CONTINUOUS QUERY \"myquery\" ON \"mydb\"",
+		"CREATE USER \"jdoe\" WITH PASSWORD '1337password'",
+		"DROP USER \"jdoe\"",
+		"GRANT READ ON \"mydb\" TO \"jdoe\"",
+		"REVOKE ALL PRIVILEGES FROM \"jdoe\"",
+	} {
+		if !CheckBroadcastFromTokens(ScanTokens(q, 0)) {
+			t.Errorf("statement should be broadcast: %s", q)
+		}
+		if _, check, _ := CheckQuery(q); !check {
+			t.Errorf("statement should be supported: %s", q)
+		}
+	}
+	if CheckBroadcastFromTokens(ScanTokens("SHOW CONTINUOUS QUERIES", 0)) {
+		t.Errorf("show statement should not be broadcast")
+	}
+}
+
+func TestRetentionPolicyStatement(t *testing.T) {
+	rp := &retentionPolicy{name: "rp", duration: "168h0m0s", shardDuration: "24h0m0s", replication: 1, isDefault: true}
+	want := "create retention policy \"rp\" on \"db\" duration 7d replication 1 shard duration 1d default"
+	if q := rp.createStatement("db"); q != want {
+		t.Errorf("create statement wrong: %s != %s", q, want)
+	}
+	if d := formatDuration("0s"); d != "INF" {
+		t.Errorf("infinite duration wrong: %s", d)
+	}
+	if d := formatDuration("1h30m0s"); d != "90m" {
+		t.Errorf("duration wrong: %s", d)
+	}
+}
+
+func TestBroadcastQuery(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results":[{"statement_id":0}]}`))
+	}))
+	defer ok.Close()
+	failed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results":[{"statement_id":0,"error":"user already exists"}]}`))
+	}))
+	defer failed.Close()
+
+	req := NewQueryRequest("POST", "", "create user \"jdoe\" with password 'secret'")
+	ip := &Proxy{Circles: []*Circle{newTestCircle(0, ok.URL), newTestCircle(1, ok.URL)}}
+	if _, err := ip.broadcastQuery(req, httptest.NewRecorder()); err != nil {
+		t.Errorf("broadcast should succeed: %s", err)
+	}
+	ip = &Proxy{Circles: []*Circle{newTestCircle(0, ok.URL), newTestCircle(1, failed.URL)}}
+	_, err := ip.broadcastQuery(req, httptest.NewRecorder())
+	if err == nil || !strings.Contains(err.Error(), "1/2 backends failed") || !strings.Contains(err.Error(), "user already exists") {
+		t.Errorf("broadcast should report the failed backend: %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package backend
+
+import (
+	"bytes"
+	"strings"
+)
+
+// BackendPlan is a backend which a line or query would be routed to
+type BackendPlan struct {
+	CircleId int    `json:"circle_id"` // nolint:golint
+	Circle   string `json:"circle"`
+	Backend  string `json:"backend"`
+	Url      string `json:"url"` // nolint:golint
+	Active   bool   `json:"active"`
+}
+
+// LinePlan is the routing plan of a line protocol line
+type LinePlan struct {
+	Line        string         `json:"line"`
+	Measurement string         `json:"measurement,omitempty"`
+	Key         string         `json:"key,omitempty"`
+	Valid       bool           `json:"valid"`
+	Dropped     bool           `json:"dropped"`
+	Reason      string         `json:"reason,omitempty"`
+	Backends    []*BackendPlan `json:"backends,omitempty"`
+}
+
+// QueryPlan is the routing plan of a query
+type QueryPlan struct {
+	Statement   string         `json:"statement"`
+	Type        string         `json:"type"`
+	Db          string         `json:"db,omitempty"`
+	Rp          string         `json:"rp,omitempty"`
+	Measurement string         `json:"measurement,omitempty"`
+	Key         string         `json:"key,omitempty"`
+	Strategy    string         `json:"strategy,omitempty"`
+	Hedged      bool           `json:"hedged,omitempty"`
+	Err         string         `json:"error,omitempty"`
+	Backends    []*BackendPlan `json:"backends,omitempty"`
+}
+
+func newBackendPlan(circle *Circle, be *Backend) *BackendPlan {
+	return &BackendPlan{CircleId: circle.CircleId, Circle: circle.Name, Backend: be.Name, Url: be.Url, Active: be.IsActive()}
+}
+
+// GetRetentionPolicyFromTokens returns the retention policy of source like "db"."rp"."meas" or "rp"."meas"
+func GetRetentionPolicyFromTokens(tokens []string) string {
+	for i := 0; i+1 < len(tokens); i++ {
+		if strings.ToLower(tokens[i]) != "from" {
+			continue
+		}
+		source := tokens[i+1]
+		for j := i + 2; j+1 < len(tokens) && (tokens[j] == "." || tokens[j] == ".."); j += 2 {
+			source += tokens[j] + tokens[j+1]
+		}
+		if source[0] == '/' {
+			return ""
+		}
+		segments, err := splitIdentifier(source)
+		if err != nil {
+			return ""
+		}
+		switch len(segments) {
+		case 2:
+			return segments[0]
+		case 3:
+			return segments[1]
+		}
+		return ""
+	}
+	return ""
+}
+
+// RouteLines returns the routing plan of lines without writing them
+func (ip *Proxy) RouteLines(p []byte, db, precision string) (plans []*LinePlan) {
+	for _, line := range bytes.Split(p, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		plan := &LinePlan{Line: string(line)}
+		plans = append(plans, plan)
+		nanoLine := AppendNano(line, precision)
+		meas, err := ScanKey(nanoLine)
+		if err != nil {
+			plan.Dropped, plan.Reason = true, "scan key error: "+err.Error()
+			continue
+		}
+		plan.Measurement = meas
+		if !RapidCheck(nanoLine[len(meas):]) {
+			plan.Dropped, plan.Reason = true, "invalid format"
+			continue
+		}
+		plan.Valid = true
+		if len(ip.DBSet) > 0 && !ip.DBSet[db] {
+			plan.Dropped, plan.Reason = true, "database forbidden: "+db
+			continue
+		}
+		plan.Key = GetKey(db, meas)
+		for _, circle := range ip.Circles {
+			plan.Backends = append(plan.Backends, newBackendPlan(circle, circle.GetBackend(plan.Key)))
+		}
+	}
+	return
+}
+
+// RouteQuery returns the routing plan of query without executing it
+func (ip *Proxy) RouteQuery(q, db, rp string) (plan *QueryPlan) {
+	plan = &QueryPlan{Statement: q}
+	tokens, check, from := CheckQuery(q)
+	if !check {
+		plan.Type, plan.Err = "unsupported", ErrIllegalQL.Error()
+		return
+	}
+	checkDb, showDb, alterDb, tokenDb := CheckDatabaseFromTokens(tokens)
+	broadcast := CheckBroadcastFromTokens(tokens)
+	if checkDb {
+		db = tokenDb
+	} else if db == "" || broadcast {
+		db, _ = GetDatabaseFromTokens(tokens)
+	}
+	plan.Db = db
+	if plan.Rp = GetRetentionPolicyFromTokens(tokens); plan.Rp == "" {
+		plan.Rp = rp
+	}
+	if !showDb && db == "" && !broadcast {
+		plan.Err = ErrDatabaseNotFound.Error()
+	} else if !showDb && db != "" && len(ip.DBSet) > 0 && !ip.DBSet[db] {
+		plan.Err = "database forbidden: " + db
+	}
+
+	explain, _, selectTokens := CheckExplainFromTokens(tokens)
+	stmt2 := GetHeadStmtFromTokens(tokens, 2)
+	selectOrShow := CheckSelectOrShowFromTokens(tokens)
+	switch {
+	case stmt2 == "show queries":
+		plan.Type = "show queries"
+		plan.Backends = ip.allBackendPlans()
+	case stmt2 == "kill query":
+		plan.Type = "kill query"
+		name, _, err := parseQueryID(tokens)
+		if err != nil {
+			plan.Err = err.Error()
+		}
+		for _, bp := range ip.allBackendPlans() {
+			if bp.Backend == name {
+				plan.Backends = append(plan.Backends, bp)
+			}
+		}
+	case explain || (selectOrShow && from):
+		plan.Type = strings.ToLower(selectTokens[0])
+		if explain {
+			plan.Type = "explain"
+		} else if CheckSelectIntoFromTokens(tokens) {
+			plan.Type = "select into"
+		}
+		plan.Strategy = ip.readStrategy
+		plan.Hedged = ip.hedger != nil && plan.Type == "select"
+		ip.routeByKey(plan, selectTokens, ip.peekReadableCircles(), true)
+	case selectOrShow && !from:
+		plan.Type = "show"
+		plan.Strategy = ip.readStrategy
+		for _, circle := range ip.peekReadableCircles() {
+			for _, be := range circle.Backends {
+				plan.Backends = append(plan.Backends, newBackendPlan(circle, be))
+			}
+		}
+	case CheckDeleteOrDropMeasurementFromTokens(tokens):
+		plan.Type = "delete"
+		ip.routeByKey(plan, tokens, ip.Circles, false)
+	case alterDb || broadcast:
+		plan.Type = "broadcast"
+		plan.Backends = ip.allBackendPlans()
+	default:
+		plan.Type, plan.Err = "unsupported", ErrIllegalQL.Error()
+	}
+	return
+}
+
+// routeByKey adds the backends of measurement key in circles, all backends of circles if measurement is a regex
+func (ip *Proxy) routeByKey(plan *QueryPlan, tokens []string, circles []*Circle, regex bool) {
+	meas, err := GetMeasurementFromTokens(tokens)
+	if err != nil {
+		plan.Err = ErrGetMeasurement.Error()
+		return
+	}
+	plan.Measurement = meas
+	if regex && meas[0] == '/' {
+		for _, circle := range circles {
+			for _, be := range circle.Backends {
+				plan.Backends = append(plan.Backends, newBackendPlan(circle, be))
+			}
+		}
+		return
+	}
+	plan.Key = GetKey(plan.Db, meas)
+	for _, circle := range circles {
+		plan.Backends = append(plan.Backends, newBackendPlan(circle, circle.GetBackend(plan.Key)))
+	}
+}
+
+func (ip *Proxy) allBackendPlans() (plans []*BackendPlan) {
+	for _, circle := range ip.Circles {
+		for _, be := range circle.Backends {
+			plans = append(plans, newBackendPlan(circle, be))
+		}
+	}
+	return
+}
@@ -0,0 +1,66 @@
+package backend
+
+import (
+	"testing"
+)
+
+func TestGetRetentionPolicyFromTokens(t *testing.T) {
+	tests := map[string]string{
+		"select * from cpu":                   "",
+		"select * from \"rp\".\"cpu\"":        "rp",
+		"select * from \"db\".\"rp\".\"cpu\"": "rp",
+		"select * from \"db\"..\"cpu\"":       "",
+		"select * from db.autogen.cpu":        "autogen",
+		"select * from /cpu.*/":               "",
+	}
+	for q, rp := range tests {
+		if r := GetRetentionPolicyFromTokens(ScanTokens(q, 0)); r != rp {
+			t.Errorf("%s: rp %q != %q", q, r, rp)
+		}
+	}
+}
+
+func TestRouteLines(t *testing.T) {
+	ip := &Proxy{Circles: []*Circle{newTestCircle(0, "http://127.0.0.1:8086"), newTestCircle(1, "http://127.0.0.1:8087")}}
+	plans := ip.RouteLines([]byte("cpu,host=a value=1 1\n\n# comment\ncpu,host=a\n"), "db", "s")
+	if len(plans) != 2 {
+		t.Fatalf("wrong number of plans: %d", len(plans))
+	}
+	if p := plans[0]; !p.Valid || p.Dropped || p.Key != "db,cpu" || len(p.Backends) != 2 || p.Backends[1].Url != "http://127.0.0.1:8087" {
+		t.Errorf("wrong plan of valid line: %+v", p)
+	}
+	if p := plans[1]; p.Valid || !p.Dropped || p.Reason == "" || len(p.Backends) != 0 {
+		t.Errorf("wrong plan of invalid line: %+v", p)
+	}
+}
+
+func TestRouteQuery(t *testing.T) {
+	ip := &Proxy{Circles: []*Circle{newTestCircle(0, "http://127.0.0.1:8086"), newTestCircle(1, "http://127.0.0.1:8087")}, balancer: &RoundRobinBalancer{}, readStrategy: StrategyRoundRobin}
+	plan := ip.RouteQuery("select * from \"autogen\".\"cpu\"", "db", "")
+	if plan.Type != "select" || plan.Rp != "autogen" || plan.Measurement != "cpu" || plan.Key != "db,cpu" || plan.Strategy != StrategyRoundRobin || len(plan.Backends) != 2 || plan.Err != "" {
+		t.Errorf("wrong select plan: %+v", plan)
+	}
+	if plan = ip.RouteQuery("show measurements", "", ""); plan.Err != ErrDatabaseNotFound.Error() {
+		t.Errorf("show without db should fail: %+v", plan)
+	}
+	if plan = ip.RouteQuery("drop measurement cpu", "db", ""); plan.Type != "delete" || len(plan.Backends) != 2 {
+		t.Errorf("wrong drop plan: %+v", plan)
+	}
+	if plan = ip.RouteQuery("create user \"jdoe\" with password 'x'", "", ""); plan.Type != "broadcast" || plan.Err != "" {
+		t.Errorf("wrong broadcast plan: %+v", plan)
+	}
+	if plan = ip.RouteQuery("select 1", "db", ""); plan.Type != "unsupported" {
+		t.Errorf("wrong unsupported plan: %+v", plan)
+	}
+
+	// dry run reports the next order of round robin without advancing it
+	for i := 0; i < 3; i++ {
+		plan = ip.RouteQuery("select * from cpu", "db", "")
+		if plan.Backends[0].CircleId != 0 {
+			t.Errorf("dry run should not advance round robin: %+v", plan.Backends[0])
+		}
+	}
+	if circles := ip.readableCircles(); circles[0] != ip.Circles[0] {
+		t.Errorf("live query should start from the circle of dry run: %d", circles[0].CircleId)
+	}
+}
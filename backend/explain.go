@@ -0,0 +1,114 @@
+package backend
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// CheckExplainFromTokens checks if the query is explain or explain analyze, and returns the tokens of explained select
+func CheckExplainFromTokens(tokens []string) (explain bool, analyze bool, selectTokens []string) {
+	if len(tokens) < 2 || strings.ToLower(tokens[0]) != "explain" {
+		return false, false, tokens
+	}
+	selectTokens = tokens[1:]
+	if strings.ToLower(selectTokens[0]) == "analyze" {
+		analyze = true
+		selectTokens = selectTokens[1:]
+	}
+	if len(selectTokens) == 0 || strings.ToLower(selectTokens[0]) != "select" {
+		return false, false, tokens
+	}
+	return true, analyze, selectTokens
+}
+
+type explainResult struct {
+	circle  *Circle
+	be      *Backend
+	qr      *QueryResult
+	latency time.Duration
+}
+
+// explainQuery routes explain to the backend of measurement like select, or to all backends of a circle if measurement
+// is a regex, and appends a proxy section describing the routing and the latency of backends
+func (ip *Proxy) explainQuery(w http.ResponseWriter, req *http.Request, tokens []string, db string) (body []byte, err error) {
+	meas, err := GetMeasurementFromTokens(tokens)
+	if err != nil {
+		return nil, ErrGetMeasurement
+	}
+	key := GetKey(db, meas)
+	contentType := GetContentType(req)
+	req.Header.Set("Accept", ContentTypeJSON)
+	req.Header.Del("Accept-Encoding")
+
+	var results []*explainResult
+	for _, circle := range ip.readableCircles() {
+		var backends []*Backend
+		if meas[0] == '/' {
+			if !circle.CheckActive() {
+				continue
+			}
+			backends = circle.Backends
+		} else if be := circle.GetBackend(key); be.IsActive() {
+			backends = []*Backend{be}
+		} else {
+			continue
+		}
+		results = ip.explainBackends(circle, backends, req)
+		break
+	}
+	if len(results) == 0 {
+		return nil, ErrBackendsUnavailable
+	}
+
+	plan := []string{fmt.Sprintf("measurement: %s, key: %s", meas, key)}
+	var series models.Rows
+	for _, er := range results {
+		if er.qr.Err == nil {
+			er.qr.Err = statementError(er.qr.Body)
+		}
+		status := "ok"
+		if er.qr.Err != nil {
+			status = er.qr.Err.Error()
+		} else if s, err := SeriesWithNumbers(er.qr.Body); err == nil {
+			for _, row := range s {
+				row.Tags = map[string]string{"backend": er.be.Name}
+				series = append(series, row)
+			}
+		}
+		plan = append(plan, fmt.Sprintf("circle: %s, backend: %s (%s), latency: %s, status: %s",
+			er.circle.Name, er.be.Name, er.be.Url, er.latency.Truncate(time.Microsecond), status))
+	}
+	if len(results) == 1 && results[0].qr.Err != nil {
+		return nil, results[0].qr.Err
+	}
+	proxy := &models.Row{Name: "proxy", Columns: []string{"QUERY PLAN"}}
+	for _, line := range plan {
+		proxy.Values = append(proxy.Values, []interface{}{line})
+	}
+	series = append(series, proxy)
+
+	w.Header().Set("Content-Type", contentType)
+	return MarshalResponse(ResponseFromSeries(series), contentType, req.FormValue("pretty") == "true"), nil
+}
+
+func (ip *Proxy) explainBackends(circle *Circle, backends []*Backend, req *http.Request) []*explainResult {
+	results := make([]*explainResult, len(backends))
+	var wg sync.WaitGroup
+	for i, be := range backends {
+		wg.Add(1)
+		go func(i int, be *Backend) {
+			defer wg.Done()
+			start := time.Now()
+			recordRoute(req.Context(), circle, be)
+			qr := be.Query(CloneQueryRequest(req), nil, true)
+			results[i] = &explainResult{circle: circle, be: be, qr: qr, latency: time.Since(start)}
+		}(i, be)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,40 @@
+package backend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckExplainFromTokens(t *testing.T) {
+	explain, analyze, tokens := CheckExplainFromTokens(ScanTokens("EXPLAIN ANALYZE SELECT * FROM cpu", 0))
+	if !explain || !analyze || strings.Join(tokens, " ") != "SELECT * FROM cpu" {
+		t.Errorf("explain analyze wrong: %v %v %v", explain, analyze, tokens)
+	}
+	if explain, _, _ = CheckExplainFromTokens(ScanTokens("SELECT * FROM cpu", 0)); explain {
+		t.Errorf("select detected as explain")
+	}
+	if _, check, from := CheckQuery("EXPLAIN SELECT * FROM cpu"); !check || !from {
+		t.Errorf("explain should be supported")
+	}
+}
+
+func TestExplainQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results":[{"statement_id":0,"series":[{"columns":["QUERY PLAN"],"values":[["EXPRESSION: <nil>"],["NUMBER OF SHARDS: 1"]]}]}]}`))
+	}))
+	defer server.Close()
+
+	ip := &Proxy{Circles: []*Circle{newTestCircle(0, server.URL)}, Tracker: NewQueryTracker(), balancer: &RandomBalancer{}}
+	req := NewQueryRequest("GET", "db", "EXPLAIN SELECT * FROM cpu")
+	body, err := ip.Query(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"NUMBER OF SHARDS: 1", `"backend":"` + server.URL + `"`, `"name":"proxy"`, "key: db,cpu", "status: ok"} {
+		if !strings.Contains(string(body), s) {
+			t.Errorf("explain output misses %s: %s", s, body)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/influxdata/influxdb1-client/models"
+	"github.com/tinylib/msgp/msgp"
+
+	"github.com/RedTimeDB/RedTimeProxy/util"
+)
+
+const (
+	ContentTypeJSON    = "application/json"
+	ContentTypeCSV     = "text/csv"
+	ContentTypeMsgPack = "application/x-msgpack"
+)
+
+// GetContentType negotiates the response format from the Accept header, the media types are parsed with
+// their parameters, and the supported one of the highest quality wins, json is the default
+func GetContentType(req *http.Request) string {
+	contentType, quality := ContentTypeJSON, 0.0
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		var ct string
+		switch mediaType {
+		case "application/json":
+			ct = ContentTypeJSON
+		case "application/csv", "text/csv":
+			ct = ContentTypeCSV
+		case "application/x-msgpack":
+			ct = ContentTypeMsgPack
+		default:
+			continue
+		}
+		if q > quality {
+			contentType, quality = ct, q
+		}
+	}
+	return contentType
+}
+
+// MarshalResponse encodes the response with the given content type
+func MarshalResponse(rsp *Response, contentType string, pretty bool) []byte {
+	switch contentType {
+	case ContentTypeCSV:
+		return MarshalCSV(rsp)
+	case ContentTypeMsgPack:
+		return MarshalMsgPack(rsp)
+	default:
+		return util.MarshalJSON(rsp, pretty)
+	}
+}
+
+// MarshalCSV encodes the response as csv, columns header is reprinted when columns change
+func MarshalCSV(rsp *Response) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if rsp.Err != "" {
+		w.Write([]string{"error"})
+		w.Write([]string{rsp.Err})
+		w.Flush()
+		return buf.Bytes()
+	}
+
+	var header, columns []string
+	statementID := -1
+	for _, result := range rsp.Results {
+		if len(result.Series) == 0 {
+			continue
+		}
+		for _, row := range result.Series {
+			if result.StatementID != statementID || !stringsEqual(header, row.Columns) {
+				if statementID >= 0 {
+					w.Flush()
+					buf.WriteByte('\n')
+				}
+				statementID = result.StatementID
+				header = row.Columns
+				columns = make([]string, 2+len(row.Columns))
+				columns[0] = "name"
+				columns[1] = "tags"
+				copy(columns[2:], row.Columns)
+				w.Write(columns)
+			}
+			columns[0] = row.Name
+			columns[1] = ""
+			if len(row.Tags) > 0 {
+				hashKey := models.NewTags(row.Tags).HashKey()
+				if len(hashKey) > 0 {
+					columns[1] = string(hashKey[1:])
+				}
+			}
+			for _, values := range row.Values {
+				for j := range columns[2:] {
+					columns[j+2] = ""
+					if j < len(values) {
+						columns[j+2] = formatCSVValue(values[j])
+					}
+				}
+				w.Write(columns)
+			}
+		}
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+func formatCSVValue(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return formatCSVValue(numberValue(v))
+	default:
+		return ""
+	}
+}
+
+// numberValue returns the json number as int64, or uint64 beyond int64, if it has no fraction or exponent,
+// otherwise as float64
+func numberValue(n json.Number) interface{} {
+	if !strings.ContainsAny(string(n), ".eE") {
+		if i, err := n.Int64(); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+			return u
+		}
+	}
+	f, _ := n.Float64()
+	return f
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalMsgPack encodes the response as msgpack with the same layout as influxdb 1.8
+func MarshalMsgPack(rsp *Response) []byte {
+	var buf bytes.Buffer
+	enc := msgp.NewWriter(&buf)
+	enc.WriteMapHeader(1)
+	if rsp.Err != "" {
+		enc.WriteString("error")
+		enc.WriteString(rsp.Err)
+		enc.Flush()
+		return buf.Bytes()
+	}
+
+	enc.WriteString("results")
+	enc.WriteArrayHeader(uint32(len(rsp.Results)))
+	for _, result := range rsp.Results {
+		if result.Err != "" {
+			enc.WriteMapHeader(1)
+			enc.WriteString("error")
+			enc.WriteString(result.Err)
+			continue
+		}
+
+		sz := 2
+		if len(result.Messages) > 0 {
+			sz++
+		}
+		if result.Partial {
+			sz++
+		}
+		enc.WriteMapHeader(uint32(sz))
+		enc.WriteString("statement_id")
+		enc.WriteInt(result.StatementID)
+		if len(result.Messages) > 0 {
+			enc.WriteString("messages")
+			enc.WriteArrayHeader(uint32(len(result.Messages)))
+			for _, msg := range result.Messages {
+				enc.WriteMapHeader(2)
+				enc.WriteString("level")
+				enc.WriteString(msg.Level)
+				enc.WriteString("text")
+				enc.WriteString(msg.Text)
+			}
+		}
+		enc.WriteString("series")
+		enc.WriteArrayHeader(uint32(len(result.Series)))
+		for _, row := range result.Series {
+			writeMsgPackRow(enc, row)
+		}
+		if result.Partial {
+			enc.WriteString("partial")
+			enc.WriteBool(true)
+		}
+	}
+	enc.Flush()
+	return buf.Bytes()
+}
+
+func writeMsgPackRow(enc *msgp.Writer, row *models.Row) {
+	sz := 2
+	if row.Name != "" {
+		sz++
+	}
+	if len(row.Tags) > 0 {
+		sz++
+	}
+	if row.Partial {
+		sz++
+	}
+	enc.WriteMapHeader(uint32(sz))
+	if row.Name != "" {
+		enc.WriteString("name")
+		enc.WriteString(row.Name)
+	}
+	if len(row.Tags) > 0 {
+		keys := make([]string, 0, len(row.Tags))
+		for k := range row.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		enc.WriteString("tags")
+		enc.WriteMapHeader(uint32(len(keys)))
+		for _, k := range keys {
+			enc.WriteString(k)
+			enc.WriteString(row.Tags[k])
+		}
+	}
+	enc.WriteString("columns")
+	enc.WriteArrayHeader(uint32(len(row.Columns)))
+	for _, col := range row.Columns {
+		enc.WriteString(col)
+	}
+	enc.WriteString("values")
+	enc.WriteArrayHeader(uint32(len(row.Values)))
+	for _, values := range row.Values {
+		enc.WriteArrayHeader(uint32(len(values)))
+		for _, v := range values {
+			if n, ok := v.(json.Number); ok {
+				v = numberValue(n)
+			}
+			enc.WriteIntf(v)
+		}
+	}
+	if row.Partial {
+		enc.WriteString("partial")
+		enc.WriteBool(true)
+	}
+}
@@ -0,0 +1,112 @@
+package backend
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/influxdata/influxdb1-client/models"
+	"github.com/tinylib/msgp/msgp"
+)
+
+func TestGetContentType(t *testing.T) {
+	tests := []struct {
+		accept      string
+		contentType string
+	}{
+		{"", ContentTypeJSON},
+		{"text/csv", ContentTypeCSV},
+		{"text/csv; charset=utf-8", ContentTypeCSV},
+		{"Application/X-MsgPack", ContentTypeMsgPack},
+		{"text/html, application/csv;q=0.9, */*;q=0.8", ContentTypeCSV},
+		{"application/csv;q=0.5, application/x-msgpack;q=0.8", ContentTypeMsgPack},
+		{"application/json, text/csv", ContentTypeJSON},
+		{"text/csv;q=0, application/x-msgpack;q=x", ContentTypeJSON},
+		{"text/html", ContentTypeJSON},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/query", nil)
+		req.Header.Set("Accept", tt.accept)
+		if ct := GetContentType(req); ct != tt.contentType {
+			t.Errorf("accept %q: got %s, want %s", tt.accept, ct, tt.contentType)
+		}
+	}
+}
+
+func TestMarshalCSV(t *testing.T) {
+	rsp := ResponseFromSeries(models.Rows{
+		{
+			Name:    "cpu",
+			Tags:    map[string]string{"host": "server01", "region": "uswest"},
+			Columns: []string{"time", "value"},
+			Values:  [][]interface{}{{float64(1596819659000000000), 0.64}, {float64(1596819660000000000), nil}},
+		},
+		{
+			Name:    "mem",
+			Columns: []string{"time", "free", "used"},
+			Values:  [][]interface{}{{float64(1596819659000000000), float64(1024), "high"}},
+		},
+	})
+	want := "name,tags,time,value\n" +
+		"cpu,\"host=server01,region=uswest\",1596819659000000000,0.64\n" +
+		"cpu,\"host=server01,region=uswest\",1596819660000000000,\n" +
+		"\n" +
+		"name,tags,time,free,used\n" +
+		"mem,,1596819659000000000,1024,high\n"
+	if got := string(MarshalCSV(rsp)); got != want {
+		t.Errorf("csv wrong:\n%s\n!=\n%s", got, want)
+	}
+
+	want = "error\nbackends unavailable\n"
+	if got := string(MarshalCSV(ResponseFromError("backends unavailable"))); got != want {
+		t.Errorf("csv error wrong: %s != %s", got, want)
+	}
+}
+
+func TestMarshalMsgPack(t *testing.T) {
+	rsp := ResponseFromSeries(models.Rows{
+		{
+			Name:    "databases",
+			Columns: []string{"name"},
+			Values:  [][]interface{}{{"db1"}, {"db2"}},
+		},
+	})
+	got, _, err := msgp.ReadIntfBytes(MarshalMsgPack(rsp))
+	if err != nil {
+		t.Fatalf("msgpack decode error: %s", err)
+	}
+	results := got.(map[string]interface{})["results"].([]interface{})
+	series := results[0].(map[string]interface{})["series"].([]interface{})
+	row := series[0].(map[string]interface{})
+	if row["name"] != "databases" {
+		t.Errorf("msgpack name wrong: %v", row["name"])
+	}
+	values := row["values"].([]interface{})
+	if len(values) != 2 || values[1].([]interface{})[0] != "db2" {
+		t.Errorf("msgpack values wrong: %v", values)
+	}
+}
+
+func TestMarshalNumbers(t *testing.T) {
+	// 2^53 + 1 isn't representable as float64
+	body := []byte(`{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","count","mean"],"values":[[1596819659000000001,9007199254740993,0.5]]}]}]}`)
+	series, err := SeriesWithNumbers(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp := ResponseFromSeries(series)
+	want := "name,tags,time,count,mean\ncpu,,1596819659000000001,9007199254740993,0.5\n"
+	if got := string(MarshalCSV(rsp)); got != want {
+		t.Errorf("csv numbers wrong:\n%s\n!=\n%s", got, want)
+	}
+
+	got, _, err := msgp.ReadIntfBytes(MarshalMsgPack(rsp))
+	if err != nil {
+		t.Fatalf("msgpack decode error: %s", err)
+	}
+	results := got.(map[string]interface{})["results"].([]interface{})
+	row := results[0].(map[string]interface{})["series"].([]interface{})[0].(map[string]interface{})
+	values := row["values"].([]interface{})[0].([]interface{})
+	if values[0] != int64(1596819659000000001) || values[1] != int64(9007199254740993) || values[2] != 0.5 {
+		t.Errorf("msgpack numbers wrong: %#v", values)
+	}
+}
@@ -0,0 +1,214 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+var (
+	ErrGraphiteInvalidLine  = errors.New("invalid graphite line, require <metric> <value> [timestamp]")
+	ErrGraphiteInvalidValue = errors.New("invalid graphite value, NaN or Inf is not supported")
+)
+
+// GraphiteFieldName is the field used if the template has no field
+const GraphiteFieldName = "value"
+
+type graphiteTemplate struct {
+	filter []string
+	parts  []string
+	tags   map[string]string
+}
+
+// GraphiteParser converts graphite plaintext lines to points by influxdb-style templates,
+// a template is "[filter] template [tag1=value1,tag2=value2]"
+type GraphiteParser struct {
+	separator string
+	tags      map[string]string
+	templates []*graphiteTemplate
+	fallback  *graphiteTemplate
+}
+
+func NewGraphiteParser(separator string, templates []string, tags []string) (gp *GraphiteParser, err error) {
+	gp = &GraphiteParser{separator: separator, fallback: &graphiteTemplate{parts: []string{"measurement*"}}}
+	if gp.tags, err = parseGraphiteTags(strings.Join(tags, ",")); err != nil {
+		return nil, err
+	}
+	for _, s := range templates {
+		t, err := parseGraphiteTemplate(s)
+		if err != nil {
+			return nil, err
+		}
+		if len(t.filter) == 0 {
+			gp.fallback = t
+			continue
+		}
+		gp.templates = append(gp.templates, t)
+	}
+	return gp, nil
+}
+
+func parseGraphiteTemplate(s string) (t *graphiteTemplate, err error) {
+	t = &graphiteTemplate{}
+	fields := strings.Fields(s)
+	switch {
+	case len(fields) == 1:
+		t.parts = strings.Split(fields[0], ".")
+	case len(fields) == 2 && strings.Contains(fields[1], "="):
+		t.parts = strings.Split(fields[0], ".")
+		t.tags, err = parseGraphiteTags(fields[1])
+	case len(fields) == 2:
+		t.filter, t.parts = strings.Split(fields[0], "."), strings.Split(fields[1], ".")
+	case len(fields) == 3:
+		t.filter, t.parts = strings.Split(fields[0], "."), strings.Split(fields[1], ".")
+		t.tags, err = parseGraphiteTags(fields[2])
+	default:
+		return nil, fmt.Errorf("invalid graphite template: %q", s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	greedy := 0
+	for _, part := range t.parts {
+		if part == "measurement*" || part == "field*" {
+			greedy++
+		}
+	}
+	if greedy > 1 {
+		return nil, fmt.Errorf("invalid graphite template: %q, only one of measurement* or field* is allowed", s)
+	}
+	return t, nil
+}
+
+func parseGraphiteTags(s string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		if kv == "" {
+			continue
+		}
+		idx := strings.IndexByte(kv, '=')
+		if idx <= 0 || idx == len(kv)-1 {
+			return nil, fmt.Errorf("invalid graphite tag: %q, require key=value", kv)
+		}
+		tags[kv[:idx]] = kv[idx+1:]
+	}
+	return tags, nil
+}
+
+// match returns the most specific template whose filter matches the metric, an exact segment is more specific
+// than a wildcard, and a longer filter is more specific than its prefix
+func (gp *GraphiteParser) match(segments []string) *graphiteTemplate {
+	var best *graphiteTemplate
+	for _, t := range gp.templates {
+		if matchGraphiteFilter(t.filter, segments) && (best == nil || moreSpecific(t.filter, best.filter)) {
+			best = t
+		}
+	}
+	if best == nil {
+		return gp.fallback
+	}
+	return best
+}
+
+func matchGraphiteFilter(filter, segments []string) bool {
+	if len(filter) > len(segments) {
+		return false
+	}
+	for i, f := range filter {
+		if f != "*" && f != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func moreSpecific(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if (a[i] == "*") != (b[i] == "*") {
+			return b[i] == "*"
+		}
+	}
+	return len(a) > len(b)
+}
+
+// Parse converts a graphite line "<metric> <value> [timestamp]" to a line protocol line, timestamp is in seconds
+// and defaults to now if missing or -1
+func (gp *GraphiteParser) Parse(line string, now time.Time) ([]byte, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 && len(fields) != 3 {
+		return nil, ErrGraphiteInvalidLine
+	}
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid graphite value: %q", fields[1])
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, ErrGraphiteInvalidValue
+	}
+	t := now
+	if len(fields) == 3 && fields[2] != "-1" {
+		ts, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid graphite timestamp: %q", fields[2])
+		}
+		t = time.Unix(int64(ts), int64((ts-math.Floor(ts))*float64(time.Second)))
+	}
+
+	meas, tags, field := gp.apply(fields[0])
+	pt, err := models.NewPoint(meas, models.NewTags(tags), models.Fields{field: value}, t)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(pt.String()), nil
+}
+
+// apply returns the measurement, tags and field of metric by its template
+func (gp *GraphiteParser) apply(metric string) (meas string, tags map[string]string, field string) {
+	segments := strings.Split(metric, ".")
+	t := gp.match(segments)
+	tags = make(map[string]string, len(gp.tags)+len(t.tags))
+	for k, v := range gp.tags {
+		tags[k] = v
+	}
+	for k, v := range t.tags {
+		tags[k] = v
+	}
+
+	var measParts, fieldParts []string
+	parsedTags := make(map[string][]string)
+	greedy := false
+	for i, part := range t.parts {
+		if i >= len(segments) || greedy {
+			break
+		}
+		switch part {
+		case "":
+		case "measurement":
+			measParts = append(measParts, segments[i])
+		case "measurement*":
+			measParts, greedy = append(measParts, segments[i:]...), true
+		case "field":
+			fieldParts = append(fieldParts, segments[i])
+		case "field*":
+			fieldParts, greedy = append(fieldParts, segments[i:]...), true
+		default:
+			parsedTags[part] = append(parsedTags[part], segments[i])
+		}
+	}
+	for k, v := range parsedTags {
+		tags[k] = strings.Join(v, gp.separator)
+	}
+	meas, field = strings.Join(measParts, gp.separator), strings.Join(fieldParts, gp.separator)
+	if meas == "" {
+		meas = metric
+	}
+	if field == "" {
+		field = GraphiteFieldName
+	}
+	return
+}
@@ -0,0 +1,55 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGraphiteParser(t *testing.T) {
+	templates := []string{
+		"servers.* .host.measurement*",
+		"servers.web.* .host.resource.measurement.field region=eu",
+		"*.app env.service.resource.measurement dc=1",
+		"stats.* .measurement.measurement.host",
+		"measurement.field*",
+	}
+	gp, err := NewGraphiteParser(".", templates, []string{"region=us", "source=graphite"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1577836800, 0)
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"servers.localhost.cpu.load 10 1577836800", "cpu.load,host=localhost,region=us,source=graphite value=10 1577836800000000000"},
+		{"servers.web.nginx.requests.count 1.5 1577836800.5", "requests,host=web,region=eu,resource=nginx,source=graphite count=1.5 1577836800500000000"},
+		{"prod.app.api.db.latency 3", "db,dc=1,env=prod,region=us,resource=api,service=app,source=graphite value=3 1577836800000000000"},
+		{"stats.mem.used.host1 4 -1", "mem.used,host=host1,region=us,source=graphite value=4 1577836800000000000"},
+		{"cpu.usage.idle 90 1577836801", "cpu,region=us,source=graphite usage.idle=90 1577836801000000000"},
+		{"cpu 1 1577836800", "cpu,region=us,source=graphite value=1 1577836800000000000"},
+	}
+	for _, tt := range tests {
+		p, err := gp.Parse(tt.line, now)
+		if err != nil || string(p) != tt.want {
+			t.Errorf("line %q parsed wrong: %v\n got: %s\nwant: %s", tt.line, err, p, tt.want)
+		}
+	}
+
+	for _, line := range []string{"cpu", "cpu 1 2 3", "cpu x", "cpu NaN", "cpu 1 x"} {
+		if _, err := gp.Parse(line, now); err == nil {
+			t.Errorf("line %q should fail", line)
+		}
+	}
+}
+
+func TestGraphiteTemplateInvalid(t *testing.T) {
+	for _, tmpl := range []string{"measurement*.field*", "a b c d", "servers.* .host.measurement dc="} {
+		if _, err := NewGraphiteParser(".", []string{tmpl}, nil); err == nil {
+			t.Errorf("template %q should be invalid", tmpl)
+		}
+	}
+	if _, err := NewGraphiteParser(".", nil, []string{"region"}); err == nil {
+		t.Errorf("tag without value should be invalid")
+	}
+}
@@ -0,0 +1,299 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/RedTimeDB/RedTimeProxy/util"
+)
+
+var (
+	timeOperators  = util.NewSet(">=", "<=", ">", "<", "=")
+	durationRegexp = regexp.MustCompile(`(\d+)(ns|u|µ|ms|s|m|h|d|w)`)
+)
+
+var ErrNoTimeBound = errors.New("query guard: select requires a lower time bound")
+
+var guardRejections = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "redtimeproxy_query_guard_rejections_total",
+	Help: "The total number of select queries rejected by query guard",
+})
+
+type maxRowsKey struct{}
+
+// QueryGuard holds the guard policies, the policy of database overrides the default policy
+type QueryGuard struct {
+	policy   *GuardPolicy
+	dbPolicy map[string]*GuardPolicy
+}
+
+func NewQueryGuard(cfg *QueryGuardConfig) *QueryGuard {
+	policy := cfg.GuardPolicy
+	return &QueryGuard{policy: &policy, dbPolicy: cfg.DBGuard}
+}
+
+func (qg *QueryGuard) Policy(db string) *GuardPolicy {
+	if policy, ok := qg.dbPolicy[db]; ok && policy != nil {
+		return policy
+	}
+	return qg.policy
+}
+
+// WithMaxRows returns a context carrying the max rows of merged results
+func WithMaxRows(ctx context.Context, maxRows int) context.Context {
+	return context.WithValue(ctx, maxRowsKey{}, maxRows)
+}
+
+func maxRowsFromContext(ctx context.Context) int {
+	maxRows, _ := ctx.Value(maxRowsKey{}).(int)
+	return maxRows
+}
+
+// guardQuery checks the select query against the policy of database, limit and slimit above the caps are lowered,
+// it returns the query to be sent to backends
+func (ip *Proxy) guardQuery(policy *GuardPolicy, q string, tokens []string, db string) (string, error) {
+	lexemes := ScanLexemes(q)
+	if policy.RequireTimeBound || policy.MaxRange > 0 {
+		lower, upper, err := GetTimeRange(lexemes, time.Now())
+		if err != nil {
+			guardRejections.Inc()
+			return "", err
+		}
+		if lower == nil {
+			guardRejections.Inc()
+			return "", ErrNoTimeBound
+		}
+		maxRange := time.Duration(policy.MaxRange) * 24 * time.Hour
+		if policy.MaxRange > 0 && upper.Sub(*lower) > maxRange {
+			guardRejections.Inc()
+			return "", fmt.Errorf("query guard: time range %s exceeds %d days", upper.Sub(*lower), policy.MaxRange)
+		}
+	}
+	if policy.MaxRegexCardinality > 0 {
+		meas, err := GetMeasurementFromTokens(tokens)
+		if err == nil && len(meas) > 2 && meas[0] == '/' {
+			n, err := ip.countMeasurements(db, meas[1:len(meas)-1])
+			if err != nil {
+				return "", err
+			}
+			if n > policy.MaxRegexCardinality {
+				guardRejections.Inc()
+				return "", fmt.Errorf("query guard: regex source matches %d measurements, exceeds %d", n, policy.MaxRegexCardinality)
+			}
+		}
+	}
+	if policy.MaxLimit > 0 || policy.MaxSLimit > 0 {
+		q = CapLimits(lexemes, policy.MaxLimit, policy.MaxSLimit)
+	}
+	return q, nil
+}
+
+// GetTimeRange returns the earliest lower bound and the latest upper bound of time conditions in the lexemes of query,
+// lower is nil if the query has no lower bound, and upper is now if the query has no upper bound
+func GetTimeRange(lexemes []string, now time.Time) (lower *time.Time, upper time.Time, err error) {
+	var tokens []string
+	for _, lexeme := range lexemes {
+		if !isSpace(lexeme[0]) {
+			tokens = append(tokens, lexeme)
+		}
+	}
+	var hasUpper bool
+	for i := 0; i+2 < len(tokens); i++ {
+		name, op := strings.ToLower(tokens[i]), tokens[i+1]
+		if (name != "time" && name != `"time"`) || !timeOperators[op] {
+			continue
+		}
+		t, ok, err := parseTimeExpr(tokens[i+2:], now)
+		if err != nil {
+			return nil, now, err
+		}
+		if !ok {
+			continue
+		}
+		if op != "<" && op != "<=" && (lower == nil || t.Before(*lower)) {
+			lower = &t
+		}
+		if op != ">" && op != ">=" && (!hasUpper || t.After(upper)) {
+			upper, hasUpper = t, true
+		}
+	}
+	if !hasUpper {
+		upper = now
+	}
+	return
+}
+
+// parseTimeExpr parses the time expression at the head of tokens, which is now() with durations added or
+// subtracted, a time string or an integer or duration since epoch, ok is false for the other expressions
+func parseTimeExpr(tokens []string, now time.Time) (t time.Time, ok bool, err error) {
+	expr := tokens[0]
+	switch {
+	case strings.ToLower(expr) == "now" && len(tokens) >= 3 && tokens[1] == "(" && tokens[2] == ")":
+		t = now
+		for rest := tokens[3:]; len(rest) >= 2 && (rest[0] == "+" || rest[0] == "-"); rest = rest[2:] {
+			d, err := ParseDuration(rest[1])
+			if err != nil {
+				return t, false, err
+			}
+			if rest[0] == "-" {
+				d = -d
+			}
+			t = t.Add(d)
+		}
+		return t, true, nil
+	case expr[0] == '\'' && len(expr) >= 2:
+		s := expr[1 : len(expr)-1]
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02"} {
+			if t, err = time.Parse(layout, s); err == nil {
+				return t, true, nil
+			}
+		}
+		return t, false, fmt.Errorf("query guard: invalid time %s", expr)
+	case isDigit(expr[0]):
+		if n, err := strconv.ParseInt(expr, 10, 64); err == nil {
+			return time.Unix(0, n), true, nil
+		}
+		d, err := ParseDuration(expr)
+		if err != nil {
+			return t, false, err
+		}
+		return time.Unix(0, int64(d)), true, nil
+	}
+	return t, false, nil
+}
+
+// ParseDuration parses the InfluxQL duration literal like 1h30m or 7d
+func ParseDuration(s string) (d time.Duration, err error) {
+	units := map[string]time.Duration{
+		"ns": time.Nanosecond, "u": time.Microsecond, "µ": time.Microsecond, "ms": time.Millisecond,
+		"s": time.Second, "m": time.Minute, "h": time.Hour, "d": 24 * time.Hour, "w": 7 * 24 * time.Hour,
+	}
+	matches := durationRegexp.FindAllStringSubmatchIndex(s, -1)
+	pos := 0
+	for _, m := range matches {
+		if m[0] != pos {
+			break
+		}
+		n, _ := strconv.ParseInt(s[m[2]:m[3]], 10, 64)
+		d += time.Duration(n) * units[s[m[4]:m[5]]]
+		pos = m[1]
+	}
+	if pos == 0 || pos != len(s) {
+		return 0, fmt.Errorf("query guard: invalid duration %s", s)
+	}
+	return
+}
+
+// CapLimits lowers limit and slimit in the lexemes of query to the caps, zero cap means no cap,
+// it returns the query joined by lexemes, so quoted identifiers and strings are left as is
+func CapLimits(lexemes []string, maxLimit, maxSLimit int) string {
+	var b strings.Builder
+	var limit int
+	for _, lexeme := range lexemes {
+		switch {
+		case isSpace(lexeme[0]):
+		case strings.EqualFold(lexeme, "limit"):
+			limit = maxLimit
+		case strings.EqualFold(lexeme, "slimit"):
+			limit = maxSLimit
+		default:
+			if n, err := strconv.Atoi(lexeme); err == nil && limit > 0 && n > limit {
+				lexeme = strconv.Itoa(limit)
+			}
+			limit = 0
+		}
+		b.WriteString(lexeme)
+	}
+	return b.String()
+}
+
+// LimitRows truncates the series of response to max rows, and marks the truncated results as partial
+func LimitRows(rsp *Response, maxRows int) (truncated bool) {
+	if maxRows <= 0 {
+		return false
+	}
+	rows := 0
+	for _, result := range rsp.Results {
+		for i, row := range result.Series {
+			if rows+len(row.Values) <= maxRows {
+				rows += len(row.Values)
+				continue
+			}
+			row.Values = row.Values[:maxRows-rows]
+			row.Partial = true
+			rows = maxRows
+			if len(row.Values) == 0 {
+				i--
+			}
+			result.Series = result.Series[:i+1]
+			result.Partial = true
+			truncated = true
+			break
+		}
+	}
+	return
+}
+
+// limitBody truncates the json body answered by backend to max rows, and encodes it with the content type,
+// the numbers are kept as json.Number so that integers beyond 2^53 are exact
+func limitBody(qr *QueryResult, contentType string, pretty bool, maxRows int) (err error) {
+	body := qr.Body
+	gzipped := qr.Header.Get("Content-Encoding") == "gzip"
+	if gzipped {
+		if body, err = util.GzipDecompress(body); err != nil {
+			return
+		}
+	}
+	rsp, err := ResponseWithNumbers(body)
+	if err != nil {
+		return
+	}
+	// the json body is passed through as is if nothing is truncated
+	if !LimitRows(rsp, maxRows) && contentType == ContentTypeJSON {
+		return
+	}
+	body = MarshalResponse(rsp, contentType, pretty)
+	if gzipped {
+		if body, err = util.GzipCompress(body); err != nil {
+			return
+		}
+	}
+	header := http.Header{}
+	CopyHeader(header, qr.Header)
+	header.Set("Content-Type", contentType)
+	header.Del("Content-Length")
+	qr.Header, qr.Body = header, body
+	return
+}
+
+// countMeasurements counts the measurements matching regex in all backends of an available circle
+func (ip *Proxy) countMeasurements(db, regex string) (int, error) {
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return 0, err
+	}
+	for _, circle := range ip.readableCircles() {
+		if !circle.CheckActive() {
+			continue
+		}
+		n := 0
+		for _, be := range circle.Backends {
+			for _, meas := range be.GetMeasurements(db) {
+				if re.MatchString(meas) {
+					n++
+				}
+			}
+		}
+		return n, nil
+	}
+	return 0, ErrBackendsUnavailable
+}
@@ -0,0 +1,95 @@
+package backend
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func TestGetTimeRange(t *testing.T) {
+	now := time.Date(2020, 1, 10, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		q     string
+		lower time.Duration
+		upper time.Duration
+		bound bool
+	}{
+		{"select * from cpu", 0, 0, false},
+		{"select * from cpu where time < now()", 0, 0, false},
+		{"select * from cpu where time > now() - 1h", -time.Hour, 0, true},
+		{"select * from cpu where host='a' and time>=now()-7d and time <= now() - 1d", -7 * 24 * time.Hour, -24 * time.Hour, true},
+		{"select * from cpu where time > '2020-01-01T00:00:00Z' and time < '2020-01-02'", -9 * 24 * time.Hour, -8 * 24 * time.Hour, true},
+		{"select * from cpu where \"time\" >= 1578528000000000000", -24 * time.Hour, 0, true},
+		{"select * from cpu where time > 1578528000s group by time(1h)", -24 * time.Hour, 0, true},
+		{"select * from cpu where (time > now() - 1h) and host = 'a'", -time.Hour, 0, true},
+		{"select * from cpu where host = 'time > now() - 1h'", 0, 0, false},
+		{"select \"time > now() - 1h\" from cpu where time > now() - 2h", -2 * time.Hour, 0, true},
+	}
+	for _, tt := range tests {
+		lower, upper, err := GetTimeRange(ScanLexemes(tt.q), now)
+		if err != nil {
+			t.Errorf("%s: %s", tt.q, err)
+			continue
+		}
+		if (lower != nil) != tt.bound || (lower != nil && lower.Sub(now) != tt.lower) || upper.Sub(now) != tt.upper {
+			t.Errorf("%s: wrong range %v %v", tt.q, lower, upper)
+		}
+	}
+	if _, _, err := GetTimeRange(ScanLexemes("select * from cpu where time > now() - 1x"), now); err == nil {
+		t.Errorf("invalid duration should fail")
+	}
+}
+
+func TestCapLimits(t *testing.T) {
+	q := CapLimits(ScanLexemes("select * from cpu limit 5000 slimit 10 offset 2"), 1000, 100)
+	if q != "select * from cpu limit 1000 slimit 10 offset 2" {
+		t.Errorf("wrong capped query: %s", q)
+	}
+	q = CapLimits(ScanLexemes("SELECT * FROM cpu SLIMIT 500"), 1000, 100)
+	if q != "SELECT * FROM cpu SLIMIT 100" {
+		t.Errorf("wrong capped query: %s", q)
+	}
+	q = CapLimits(ScanLexemes(`select "limit 5000" from "slimit 500" where host = 'limit 5000' limit 20`), 1000, 100)
+	if q != `select "limit 5000" from "slimit 500" where host = 'limit 5000' limit 20` {
+		t.Errorf("quoted limit should be left as is: %s", q)
+	}
+}
+
+func TestLimitRows(t *testing.T) {
+	rsp := &Response{Results: []*Result{
+		{Series: models.Rows{
+			{Name: "a", Values: [][]interface{}{{1}, {2}}},
+			{Name: "b", Values: [][]interface{}{{3}, {4}}},
+			{Name: "c", Values: [][]interface{}{{5}}},
+		}},
+		{StatementID: 1, Series: models.Rows{{Name: "d", Values: [][]interface{}{{6}}}}},
+	}}
+	if !LimitRows(rsp, 3) {
+		t.Fatalf("rows should be truncated")
+	}
+	r := rsp.Results[0]
+	if !r.Partial || len(r.Series) != 2 || len(r.Series[1].Values) != 1 || !r.Series[1].Partial {
+		t.Errorf("first result wrong: %+v", r)
+	}
+	if !rsp.Results[1].Partial || len(rsp.Results[1].Series) != 0 {
+		t.Errorf("second result wrong: %+v", rsp.Results[1])
+	}
+	if LimitRows(rsp, 10) {
+		t.Errorf("rows should not be truncated")
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	body := `{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","value"],"values":[[1596819659000000001,9007199254740993],[1596819659000000002,1]]}]}]}`
+	qr := &QueryResult{Header: http.Header{}, Body: []byte(body)}
+	if err := limitBody(qr, ContentTypeJSON, false, 10); err != nil || string(qr.Body) != body {
+		t.Errorf("untruncated body should be passed through: %s %v", qr.Body, err)
+	}
+	if err := limitBody(qr, ContentTypeJSON, false, 1); err != nil || !strings.Contains(string(qr.Body), "[[1596819659000000001,9007199254740993]]") ||
+		!strings.Contains(string(qr.Body), `"partial":true`) {
+		t.Errorf("truncated body wrong: %s %v", qr.Body, err)
+	}
+}
@@ -0,0 +1,152 @@
+package backend
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// minHedgeSamples is the number of latency samples required before the percentile delay takes effect
+const minHedgeSamples = 100
+
+var (
+	hedgeableQueries = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "redtimeproxy_hedgeable_queries_total",
+		Help: "The total number of select queries which can be hedged",
+	})
+	hedgedQueries = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "redtimeproxy_hedged_queries_total",
+		Help: "The total number of select queries sent to a second circle",
+	})
+	hedgeWins = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "redtimeproxy_hedge_wins_total",
+		Help: "The total number of hedged queries answered first by the second circle",
+	})
+)
+
+// Hedger decides the delay before a select query is sent to a second circle
+type Hedger struct {
+	delay      time.Duration
+	percentile float64
+	samples    []time.Duration
+	pos        int
+	count      int
+	current    time.Duration
+	lock       sync.Mutex
+}
+
+func NewHedger(cfg *HedgeConfig) *Hedger {
+	return &Hedger{
+		delay:      time.Duration(cfg.Delay) * time.Millisecond,
+		percentile: cfg.Percentile,
+		samples:    make([]time.Duration, cfg.Window),
+		current:    time.Duration(cfg.Delay) * time.Millisecond,
+	}
+}
+
+// Delay returns the configured delay, or the latency percentile of recent queries if configured
+func (h *Hedger) Delay() time.Duration {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.current
+}
+
+// Observe records the latency of an answered query, and recomputes the percentile delay periodically
+func (h *Hedger) Observe(latency time.Duration) {
+	if h.percentile <= 0 {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.samples[h.pos] = latency
+	h.pos = (h.pos + 1) % len(h.samples)
+	if h.count < len(h.samples) {
+		h.count++
+	}
+	if h.count < minHedgeSamples || h.pos%minHedgeSamples != 0 {
+		return
+	}
+	sorted := make([]time.Duration, h.count)
+	copy(sorted, h.samples[:h.count])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(float64(h.count)*h.percentile/100) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	h.current = sorted[idx]
+	if h.current < h.delay {
+		h.current = h.delay
+	}
+}
+
+type hedgeResult struct {
+	idx     int
+	qr      *QueryResult
+	latency time.Duration
+}
+
+// queryHedged queries the backend of the first readable circle, the same query is sent to the next circle
+// if no answer arrives within the hedge delay, then the first answer wins and the other is canceled
+func (ip *Proxy) queryHedged(circles []*Circle, key string, req *http.Request) (qr *QueryResult) {
+	var candidates []*Circle
+	for _, circle := range circles {
+		if circle.GetBackend(key).IsActive() {
+			candidates = append(candidates, circle)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	hedgeableQueries.Inc()
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	ch := make(chan *hedgeResult, len(candidates))
+	next, running, hedgeIdx := 0, 0, -1
+	launch := func() {
+		idx, circle := next, candidates[next]
+		cr := CloneQueryRequest(req).WithContext(ctx)
+		next++
+		running++
+		go func() {
+			start := time.Now()
+			ch <- &hedgeResult{idx: idx, qr: circle.QueryBackend(circle.GetBackend(key), cr, nil), latency: time.Since(start)}
+		}()
+	}
+
+	launch()
+	timer := time.NewTimer(ip.hedger.Delay())
+	defer timer.Stop()
+	timerC := timer.C
+	for running > 0 {
+		select {
+		case hr := <-ch:
+			running--
+			if hr.qr.Status > 0 {
+				ip.hedger.Observe(hr.latency)
+				if hr.idx == hedgeIdx {
+					hedgeWins.Inc()
+				}
+				return hr.qr
+			}
+			qr = hr.qr
+			// fall back to the next circle like the retry loop does
+			if next < len(candidates) && ctx.Err() == nil {
+				launch()
+			}
+		case <-timerC:
+			timerC = nil
+			if next < len(candidates) {
+				hedgedQueries.Inc()
+				hedgeIdx = next
+				launch()
+			}
+		}
+	}
+	return
+}
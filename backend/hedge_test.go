@@ -0,0 +1,57 @@
+package backend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"stathat.com/c/consistent"
+)
+
+func newTestCircle(id int, url string) *Circle {
+	ic := &Circle{CircleId: id, router: consistent.New(), mapToBackend: make(map[string]*Backend)}
+	be := NewSimpleBackend(&Config{Name: url, Url: url})
+	ic.Backends = []*Backend{be}
+	ic.addRouter(be, 0, "idx")
+	return ic
+}
+
+func TestHedgerDelay(t *testing.T) {
+	h := NewHedger(&HedgeConfig{Delay: 10, Percentile: 90, Window: 1000})
+	if h.Delay() != 10*time.Millisecond {
+		t.Errorf("delay wrong before enough samples: %s", h.Delay())
+	}
+	for i := 1; i <= 100; i++ {
+		h.Observe(time.Duration(i) * time.Millisecond)
+	}
+	if h.Delay() != 90*time.Millisecond {
+		t.Errorf("percentile delay wrong: %s", h.Delay())
+	}
+}
+
+func TestQueryHedged(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+		w.Write([]byte("slow"))
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+
+	ip := &Proxy{hedger: NewHedger(&HedgeConfig{Delay: 20, Window: 1000})}
+	circles := []*Circle{newTestCircle(0, slow.URL), newTestCircle(1, fast.URL)}
+	start := time.Now()
+	qr := ip.queryHedged(circles, GetKey("db", "cpu"), NewQueryRequest("GET", "db", "select * from cpu"))
+	if qr == nil || qr.Err != nil || string(qr.Body) != "fast" {
+		t.Fatalf("hedged query should be answered by the second circle: %+v", qr)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("hedged query took too long: %s", time.Since(start))
+	}
+}
@@ -2,6 +2,7 @@ package backend
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -24,13 +25,15 @@ var (
 	ErrNotFound     = errors.New("not found")
 	ErrInternal     = errors.New("internal error")
 	ErrUnknown      = errors.New("unknown error")
+	ErrQueryTimeout = errors.New("query timeout exceeded")
 )
 
 type QueryResult struct {
-	Header http.Header
-	Status int
-	Body   []byte
-	Err    error
+	Header  http.Header
+	Status  int
+	Body    []byte
+	Err     error
+	Backend string
 }
 
 type HttpBackend struct { // nolint:golint
@@ -42,6 +45,9 @@ type HttpBackend struct { // nolint:golint
 	Username   string
 	Password   string
 	AuthSecure bool
+	Type       string
+	Org        string
+	Token      string
 	Active     bool
 	sync.RWMutex
 }
@@ -62,6 +68,9 @@ func NewSimpleHttpBackend(cfg *Config) (hb *HttpBackend) { // nolint:golint
 		Username:   cfg.Username,
 		Password:   cfg.Password,
 		AuthSecure: cfg.AuthSecure,
+		Type:       cfg.Type,
+		Org:        cfg.Org,
+		Token:      cfg.Token,
 		Active:     true,
 	}
 	return
@@ -101,6 +110,7 @@ func CloneQueryRequest(r *http.Request) *http.Request {
 	// partial copy on demand
 	cr := new(http.Request)
 	*cr = *r
+	cr.Header = r.Header.Clone()
 	cr.Body = ioutil.NopCloser(&bytes.Buffer{})
 	cr.Form = CloneForm(r.Form)
 	return cr
@@ -150,6 +160,47 @@ func (hb *HttpBackend) SetBasicAuth(req *http.Request) {
 	SetBasicAuth(req, hb.Username, hb.Password, hb.AuthSecure)
 }
 
+// SetAuth sets the token of v2 backend, or the basic auth of v1 backend
+func (hb *HttpBackend) SetAuth(req *http.Request) {
+	if hb.IsV2() {
+		if hb.Token != "" {
+			token := hb.Token
+			if hb.AuthSecure {
+				token = util.AesDecrypt(token)
+			}
+			req.Header.Set("Authorization", "Token "+token)
+		}
+		return
+	}
+	if hb.Username != "" || hb.Password != "" {
+		hb.SetBasicAuth(req)
+	}
+}
+
+func (hb *HttpBackend) IsV2() bool {
+	return hb.Type == BackendTypeV2
+}
+
+// writeURL returns /write of v1 backend, or /api/v2/write to bucket db/rp of v2 backend in nanosecond precision,
+// rp defaults to autogen as the buckets created by influxd upgrade
+func (hb *HttpBackend) writeURL(db, rp string) string {
+	q := url.Values{}
+	if hb.IsV2() {
+		if rp == "" {
+			rp = "autogen"
+		}
+		q.Set("org", hb.Org)
+		q.Set("bucket", db+"/"+rp)
+		q.Set("precision", "ns")
+		return hb.Url + "/api/v2/write?" + q.Encode()
+	}
+	q.Set("db", db)
+	if rp != "" {
+		q.Set("rp", rp)
+	}
+	return hb.Url + "/write?" + q.Encode()
+}
+
 func (hb *HttpBackend) CheckActive() {
 	for {
 		hb.SetActive(hb.Ping())
@@ -167,14 +218,19 @@ func (hb *HttpBackend) IsActive() bool {
 	return hb.Active
 }
 
+// Ping checks /ping of v1 backend, or /health of v2 backend
 func (hb *HttpBackend) Ping() bool {
-	resp, err := hb.client.Get(hb.Url + "/ping")
+	path, status := "/ping", 204
+	if hb.IsV2() {
+		path, status = "/health", 200
+	}
+	resp, err := hb.client.Get(hb.Url + path)
 	if err != nil {
 		log.Print("http error: ", err)
 		return false
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode != 204 {
+	if resp.StatusCode != status {
 		log.Printf("ping status code: %d, the backend is %s", resp.StatusCode, hb.Url)
 		return false
 	}
@@ -190,28 +246,24 @@ func (hb *HttpBackend) Write(db string, p []byte) (err error) {
 	// 	return
 	// }
 	buf := bytes.NewBuffer(p)
-	return hb.WriteStream(db, buf, false)
+	return hb.WriteStream(db, "", buf, false)
 }
 
 //写入压缩数据
 func (hb *HttpBackend) WriteCompressed(db string, p []byte) (err error) {
 	buf := bytes.NewBuffer(p)
-	return hb.WriteStream(db, buf, true)
+	return hb.WriteStream(db, "", buf, true)
 }
 
 //非压缩：写入数据
-func (hb *HttpBackend) WriteUNCompressed(db string, p []byte) (err error) {
+func (hb *HttpBackend) WriteUNCompressed(db, rp string, p []byte) (err error) {
 	buf := bytes.NewBuffer(p)
-	return hb.WriteStream(db, buf, false)
+	return hb.WriteStream(db, rp, buf, false)
 }
 
-func (hb *HttpBackend) WriteStream(db string, stream io.Reader, compressed bool) (err error) {
-	q := url.Values{}
-	q.Set("db", db)
-	req, err := http.NewRequest("POST", hb.Url+"/write?"+q.Encode(), stream)
-	if hb.Username != "" || hb.Password != "" {
-		hb.SetBasicAuth(req)
-	}
+func (hb *HttpBackend) WriteStream(db, rp string, stream io.Reader, compressed bool) (err error) {
+	req, err := http.NewRequest("POST", hb.writeURL(db, rp), stream)
+	hb.SetAuth(req)
 
 	//压缩可能会内存泄漏
 	if compressed {
@@ -261,9 +313,7 @@ func (hb *HttpBackend) Query(req *http.Request, w http.ResponseWriter, decompres
 	req.Form.Del("u")
 	req.Form.Del("p")
 	req.ContentLength = 0
-	if hb.Username != "" || hb.Password != "" {
-		hb.SetBasicAuth(req)
-	}
+	hb.SetAuth(req)
 
 	req.URL, qr.Err = url.Parse(hb.Url + "/query?" + req.Form.Encode())
 	if qr.Err != nil {
@@ -274,9 +324,16 @@ func (hb *HttpBackend) Query(req *http.Request, w http.ResponseWriter, decompres
 	q := strings.TrimSpace(req.FormValue("q"))
 	resp, err := hb.transport.RoundTrip(req)
 	if err != nil {
-		if req.Header.Get("Query-Origin") != "Parallel" || err.Error() != "context canceled" {
+		switch req.Context().Err() {
+		case context.DeadlineExceeded:
+			qr.Err = ErrQueryTimeout
+			log.Printf("query timeout: %s, the query is %s", hb.Url, RedactPassword(q))
+		case context.Canceled:
+			// client disconnected, or a sibling of parallel query failed
+			qr.Err = context.Canceled
+		default:
 			qr.Err = err
-			log.Printf("query error: %s, the query is %s", err, q)
+			log.Printf("query error: %s, the query is %s", err, RedactPassword(q))
 		}
 		return
 	}
@@ -299,7 +356,10 @@ func (hb *HttpBackend) Query(req *http.Request, w http.ResponseWriter, decompres
 
 	qr.Body, qr.Err = ioutil.ReadAll(respBody)
 	if qr.Err != nil {
-		log.Printf("read body error: %s, the query is %s", qr.Err, q)
+		if req.Context().Err() == context.DeadlineExceeded {
+			qr.Err = ErrQueryTimeout
+		}
+		log.Printf("read body error: %s, the query is %s", qr.Err, RedactPassword(q))
 		return
 	}
 	if resp.StatusCode >= 400 {
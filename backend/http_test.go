@@ -0,0 +1,110 @@
+package backend
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHttpBackendV2(t *testing.T) {
+	var paths, auths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path+"?"+r.URL.RawQuery)
+		auths = append(auths, r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/health":
+			w.Write([]byte(`{"name":"influxdb","status":"pass"}`))
+		case "/api/v2/write":
+			if p, _ := ioutil.ReadAll(r.Body); string(p) != "cpu value=1" {
+				w.WriteHeader(400)
+				return
+			}
+			w.WriteHeader(204)
+		case "/query":
+			w.Write([]byte(`{"results":[{"statement_id":0}]}`))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	hb := NewSimpleHttpBackend(&Config{Name: "v2", Url: server.URL, Type: BackendTypeV2, Org: "my org", Token: "secret"})
+	hb.client = NewClient(false, 1)
+	if !hb.Ping() {
+		t.Errorf("v2 backend ping failed: %v", paths)
+	}
+	if err := hb.WriteUNCompressed("db", "", []byte("cpu value=1")); err != nil {
+		t.Errorf("v2 backend write failed: %v", err)
+	}
+	if err := hb.WriteUNCompressed("db", "weekly", []byte("cpu value=1")); err != nil {
+		t.Errorf("v2 backend write failed: %v", err)
+	}
+	if qr := hb.Query(NewQueryRequest("GET", "db", "select * from cpu"), nil, true); qr.Err != nil {
+		t.Errorf("v2 backend query failed: %v", qr.Err)
+	}
+	want := []string{
+		"/health?",
+		"/api/v2/write?bucket=db%2Fautogen&org=my+org&precision=ns",
+		"/api/v2/write?bucket=db%2Fweekly&org=my+org&precision=ns",
+		"/query?db=db&q=select+%2A+from+cpu",
+	}
+	if len(paths) != len(want) {
+		t.Fatalf("requests wrong: %v", paths)
+	}
+	for i := range want {
+		if paths[i] != want[i] || (i > 0 && auths[i] != "Token secret") {
+			t.Errorf("request %d wrong: %s %q", i, paths[i], auths[i])
+		}
+	}
+
+	hb = NewSimpleHttpBackend(&Config{Name: "v1", Url: server.URL, Username: "u", Password: "p"})
+	hb.client = NewClient(false, 1)
+	if hb.Ping() || paths[len(paths)-1] != "/ping?" {
+		t.Errorf("v1 backend should ping /ping: %v", paths)
+	}
+	if url := hb.writeURL("db", "weekly"); url != server.URL+"/write?db=db&rp=weekly" {
+		t.Errorf("v1 write url wrong: %s", url)
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	canceled := make(chan string, 2)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+			canceled <- r.Host
+		}
+		w.Write([]byte(`{"results":[{"statement_id":0}]}`))
+	})
+	slow1 := httptest.NewServer(handler)
+	defer slow1.Close()
+	slow2 := httptest.NewServer(handler)
+	defer slow2.Close()
+
+	ic := newTestCircle(0, slow1.URL)
+	ic.Backends = append(ic.Backends, NewSimpleBackend(&Config{Name: slow2.URL, Url: slow2.URL}))
+	ip := &Proxy{
+		Circles:        []*Circle{ic},
+		Tracker:        NewQueryTracker(),
+		balancer:       &RandomBalancer{},
+		dbQueryTimeout: map[string]time.Duration{"db": 50 * time.Millisecond},
+	}
+	start := time.Now()
+	_, err := ip.Query(httptest.NewRecorder(), NewQueryRequest("GET", "db", "SHOW MEASUREMENTS"))
+	if err != ErrQueryTimeout {
+		t.Errorf("query should time out: %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("query timeout took too long: %s", time.Since(start))
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-canceled:
+		case <-time.After(time.Second):
+			t.Fatalf("%d/2 in-flight backend requests canceled", i)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"errors"
 	"log"
+	"strconv"
 	"strings"
 
 	"github.com/RedTimeDB/RedTimeProxy/util"
@@ -19,6 +20,22 @@ var SupportCmds = util.NewSet(
 	"show retention policies",
 	"show stats",
 	"show databases",
+	"show measurement cardinality",
+	"show measurement exact cardinality",
+	"show series cardinality",
+	"show series exact cardinality",
+	"show tag key cardinality",
+	"show tag key exact cardinality",
+	"show tag values cardinality",
+	"show tag values exact cardinality",
+	"show field key cardinality",
+	"show field key exact cardinality",
+	"show continuous queries",
+	"show users",
+	"show shard groups",
+	"show diagnostics",
+	"show queries",
+	"kill query",
 	"create database",
 	"drop database",
 	"delete from",
@@ -26,6 +43,20 @@ var SupportCmds = util.NewSet(
 	"drop measurement",
 )
 
+// NoDatabaseCmds are the supported commands which don't require a database
+var NoDatabaseCmds = util.NewSet(
+	"show databases",
+	"show continuous queries",
+	"show users",
+	"show shard groups",
+	"show diagnostics",
+	"show queries",
+	"kill query",
+)
+
+// FieldTypes is the precedence of field types when they differ across shards or backends
+var FieldTypes = []string{"float", "integer", "string", "boolean"}
+
 var (
 	ErrWrongQuote     = errors.New("wrong quote")
 	ErrUnmatchedQuote = errors.New("unmatched quote")
@@ -151,6 +182,96 @@ func ScanTokens(q string, n int) (tokens []string) {
 	return
 }
 
+var (
+	// regexPrecursors are the lexemes after which a slash starts a regex literal instead of a division
+	regexPrecursors = util.NewSet("=~", "!~", ",", "(", ".", "from", "select", "by")
+	operators       = util.NewSet(">=", "<=", "!=", "<>", "=~", "!~", "::")
+)
+
+// ScanLexemes splits the statement into lexemes, which are whitespaces, quoted identifiers, strings, regexes,
+// words, numbers and operators, joining the lexemes gives the statement back, so the statement can be
+// rewritten without touching quoted identifiers and strings
+func ScanLexemes(q string) (lexemes []string) {
+	prev := ""
+	for i := 0; i < len(q); {
+		c := q[i]
+		end := i + 1
+		switch {
+		case isSpace(c):
+			for end < len(q) && isSpace(q[end]) {
+				end++
+			}
+		case c == '"' || c == '\'' || (c == '/' && regexPrecursors[strings.ToLower(prev)]):
+			for ; end < len(q) && q[end] != c; end++ {
+				if q[end] == '\\' {
+					end++
+				}
+			}
+			if end < len(q) {
+				end++
+			} else {
+				end = len(q)
+			}
+		case isWordByte(c):
+			for end < len(q) && (isWordByte(q[end]) || (q[end] == '.' && isDigit(c) && end+1 < len(q) && isDigit(q[end+1]))) {
+				end++
+			}
+		case end < len(q) && operators[q[i:end+1]]:
+			end++
+		}
+		lexemes = append(lexemes, q[i:end])
+		if !isSpace(q[i]) {
+			prev = q[i:end]
+		}
+		i = end
+	}
+	return
+}
+
+// RedactPassword replaces the password string literals of create user and set password statements
+// with [REDACTED] like influxdb, so that the statements can be logged
+func RedactPassword(q string) string {
+	if !strings.Contains(strings.ToLower(q), "password") {
+		return q
+	}
+	lexemes := ScanLexemes(q)
+	var words []string
+	password := false
+	for i, lexeme := range lexemes {
+		if isSpace(lexeme[0]) {
+			continue
+		}
+		word := strings.ToLower(lexeme)
+		switch {
+		case word == ";":
+			words, password = nil, false
+			continue
+		case word == "password":
+			stmt := strings.Join(words, " ")
+			password = strings.HasPrefix(stmt, "create user") || stmt == "set"
+		case password && lexeme[0] == '\'':
+			lexemes[i] = "[REDACTED]"
+			password = false
+		}
+		words = append(words, word)
+	}
+	return strings.Join(lexemes, "")
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isWordByte reports whether c is a byte of keyword, identifier, number or duration, bytes above ascii are
+// taken as letters, like µ of durations
+func isWordByte(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
 func GetHeadStmtFromTokens(tokens []string, n int) (stmt string) {
 	if n <= 0 || n > len(tokens) {
 		n = len(tokens)
@@ -247,13 +368,11 @@ func getMeasurement(tokens []string) (m string) {
 
 func CheckQuery(q string) (tokens []string, check bool, from bool) {
 	tokens = ScanTokens(q, 0)
-	stmt := strings.ToLower(tokens[0])
+	_, _, selectTokens := CheckExplainFromTokens(tokens)
+	stmt := strings.ToLower(selectTokens[0])
 	if stmt == "select" {
-		for i := 2; i < len(tokens); i++ {
-			stmt := strings.ToLower(tokens[i])
-			if stmt == "into" {
-				return tokens, false, false
-			}
+		for i := 2; i < len(selectTokens); i++ {
+			stmt := strings.ToLower(selectTokens[i])
 			if stmt == "from" {
 				return tokens, true, true
 			}
@@ -269,6 +388,9 @@ func CheckQuery(q string) (tokens []string, check bool, from bool) {
 			}
 		}
 	}
+	if CheckBroadcastFromTokens(tokens) {
+		return tokens, true, false
+	}
 	stmt2 := GetHeadStmtFromTokens(tokens, 2)
 	if SupportCmds[stmt2] {
 		return tokens, true, stmt2 == "delete from" || stmt2 == "drop measurement"
@@ -277,12 +399,17 @@ func CheckQuery(q string) (tokens []string, check bool, from bool) {
 	if SupportCmds[stmt3] {
 		return tokens, true, stmt3 == "drop series from"
 	}
+	for n := 4; n <= 5 && n <= len(tokens); n++ {
+		if SupportCmds[GetHeadStmtFromTokens(tokens, n)] {
+			return tokens, true, false
+		}
+	}
 	return tokens, false, false
 }
 
 func CheckDatabaseFromTokens(tokens []string) (check bool, show bool, alter bool, db string) {
 	stmt := GetHeadStmtFromTokens(tokens, 2)
-	show = stmt == "show databases"
+	show = NoDatabaseCmds[stmt] || NoDatabaseCmds[GetHeadStmtFromTokens(tokens, 3)]
 	alter = stmt == "create database" || stmt == "drop database"
 	check = show || alter
 	if alter && len(tokens) >= 3 {
@@ -304,3 +431,78 @@ func CheckDeleteOrDropMeasurementFromTokens(tokens []string) (check bool) {
 	}
 	return
 }
+
+// CheckCardinalityFromTokens checks show cardinality statements, sum is true when
+// the cardinality can be summed across backends, otherwise it should be de-duplicated
+func CheckCardinalityFromTokens(tokens []string) (check bool, sum bool) {
+	if strings.ToLower(tokens[0]) != "show" {
+		return
+	}
+	for i := 2; i < len(tokens) && i <= 4; i++ {
+		if strings.ToLower(tokens[i]) == "cardinality" {
+			stmt2 := GetHeadStmtFromTokens(tokens, 2)
+			return true, stmt2 == "show measurement" || stmt2 == "show series"
+		}
+	}
+	return
+}
+
+// GetLimitOffsetFromTokens returns the trailing limit and offset of statement
+func GetLimitOffsetFromTokens(tokens []string) (limit int, offset int) {
+	for i := len(tokens) - 2; i >= 0; i -= 2 {
+		n, err := strconv.Atoi(tokens[i+1])
+		if err != nil {
+			return
+		}
+		switch strings.ToLower(tokens[i]) {
+		case "limit":
+			limit = n
+		case "offset":
+			offset = n
+		default:
+			return
+		}
+	}
+	return
+}
+
+// RemoveLimitOffset removes the trailing limit and offset clauses of query, the clauses are matched
+// on the lexemes of query, so quoted identifiers and strings are left as is
+func RemoveLimitOffset(q string) string {
+	lexemes := ScanLexemes(q)
+	end := len(lexemes)
+	for end > 0 && isSpace(lexemes[end-1][0]) {
+		end--
+	}
+	if end > 0 && lexemes[end-1] == ";" {
+		end--
+	}
+	cut := -1
+	for i := end; ; {
+		for i > 0 && isSpace(lexemes[i-1][0]) {
+			i--
+		}
+		if i < 3 || !isUint(lexemes[i-1]) || !isSpace(lexemes[i-2][0]) ||
+			!(strings.EqualFold(lexemes[i-3], "limit") || strings.EqualFold(lexemes[i-3], "offset")) {
+			break
+		}
+		i -= 3
+		if i == 0 || !isSpace(lexemes[i-1][0]) {
+			break
+		}
+		cut = i - 1
+	}
+	if cut < 0 {
+		return q
+	}
+	return strings.Join(lexemes[:cut], "")
+}
+
+func isUint(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return s != ""
+}
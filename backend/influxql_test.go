@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -217,3 +218,107 @@ func BenchmarkGetMeasurementFromInfluxQL(b *testing.B) {
 		}
 	}
 }
+
+func TestCheckQuery(t *testing.T) {
+	assertCheckQuery(t, "SHOW MEASUREMENT CARDINALITY", true, false)
+	assertCheckQuery(t, "SHOW MEASUREMENT EXACT CARDINALITY ON mydb", true, false)
+	assertCheckQuery(t, "SHOW SERIES CARDINALITY ON mydb", true, false)
+	assertCheckQuery(t, "SHOW SERIES EXACT CARDINALITY FROM \"cpu\"", true, true)
+	assertCheckQuery(t, "SHOW TAG KEY CARDINALITY", true, false)
+	assertCheckQuery(t, "SHOW TAG VALUES CARDINALITY WITH KEY = \"myTagKey\"", true, false)
+	assertCheckQuery(t, "SHOW TAG VALUES EXACT CARDINALITY WITH KEY = \"myTagKey\"", true, false)
+	assertCheckQuery(t, "SHOW FIELD KEY CARDINALITY", true, false)
+	assertCheckQuery(t, "SHOW FIELD KEY EXACT CARDINALITY ON mydb", true, false)
+	assertCheckQuery(t, "SHOW CONTINUOUS QUERIES", true, false)
+	assertCheckQuery(t, "SHOW USERS", true, false)
+	assertCheckQuery(t, "SHOW SHARD GROUPS", true, false)
+	assertCheckQuery(t, "SHOW DIAGNOSTICS", true, false)
+	assertCheckQuery(t, "SHOW SUBSCRIPTIONS", false, false)
+}
+
+func assertCheckQuery(t *testing.T, q string, check bool, from bool) {
+	_, qc, qf := CheckQuery(q)
+	if qc != check || qf != from {
+		t.Errorf("check query wrong: %s, %t %t != %t %t", q, qc, qf, check, from)
+	}
+}
+
+func TestCheckCardinalityFromTokens(t *testing.T) {
+	tests := []struct {
+		q     string
+		check bool
+		sum   bool
+	}{
+		{"SHOW MEASUREMENT EXACT CARDINALITY ON mydb", true, true},
+		{"SHOW SERIES CARDINALITY", true, true},
+		{"SHOW TAG VALUES EXACT CARDINALITY WITH KEY = \"host\"", true, false},
+		{"SHOW FIELD KEY CARDINALITY", true, false},
+		{"SHOW SERIES", false, false},
+	}
+	for _, tt := range tests {
+		check, sum := CheckCardinalityFromTokens(ScanTokens(tt.q, 0))
+		if check != tt.check || sum != tt.sum {
+			t.Errorf("check cardinality wrong: %s, %t %t != %t %t", tt.q, check, sum, tt.check, tt.sum)
+		}
+	}
+}
+
+func TestLimitOffset(t *testing.T) {
+	q := "SHOW TAG VALUES WITH KEY = \"host\" LIMIT 10 OFFSET 5;"
+	limit, offset := GetLimitOffsetFromTokens(ScanTokens(q, 0))
+	if limit != 10 || offset != 5 {
+		t.Errorf("limit offset wrong: %d %d", limit, offset)
+	}
+	tests := []struct {
+		q  string
+		rq string
+	}{
+		{q, `SHOW TAG VALUES WITH KEY = "host"`},
+		{"SHOW FIELD KEYS limit 3 ", "SHOW FIELD KEYS"},
+		{`SHOW TAG VALUES WITH KEY = "x limit 10"`, `SHOW TAG VALUES WITH KEY = "x limit 10"`},
+		{`SHOW TAG VALUES WITH KEY = host WHERE a = 'offset 5'`, `SHOW TAG VALUES WITH KEY = host WHERE a = 'offset 5'`},
+		{`SHOW TAG KEYS FROM "limit" LIMIT 1`, `SHOW TAG KEYS FROM "limit"`},
+		{"SHOW TAG KEYS LIMIT x", "SHOW TAG KEYS LIMIT x"},
+	}
+	for _, tt := range tests {
+		if rq := RemoveLimitOffset(tt.q); rq != tt.rq {
+			t.Errorf("remove limit offset wrong: %s, %s != %s", tt.q, rq, tt.rq)
+		}
+	}
+	limit, offset = GetLimitOffsetFromTokens(ScanTokens("SHOW FIELD KEYS", 0))
+	if limit != 0 || offset != 0 {
+		t.Errorf("limit offset should be empty: %d %d", limit, offset)
+	}
+}
+
+func TestScanLexemes(t *testing.T) {
+	q := `SELECT "a b"/2 FROM /cpu\/.*/ WHERE host =~ /x/ AND time>=now()-1h AND msg = 'it\'s' LIMIT 10`
+	lexemes := ScanLexemes(q)
+	if strings.Join(lexemes, "") != q {
+		t.Fatalf("lexemes should join to query: %q", lexemes)
+	}
+	for _, lexeme := range []string{`"a b"`, "/", `/cpu\/.*/`, "/x/", "time", ">=", "now", "(", ")", "-", "1h", `'it\'s'`} {
+		found := false
+		for _, l := range lexemes {
+			found = found || l == lexeme
+		}
+		if !found {
+			t.Errorf("lexeme %s not found: %q", lexeme, lexemes)
+		}
+	}
+}
+
+func TestRedactPassword(t *testing.T) {
+	tests := [][2]string{
+		{`CREATE USER "jdoe" WITH PASSWORD 'it\'s secret' WITH ALL PRIVILEGES`, `CREATE USER "jdoe" WITH PASSWORD [REDACTED] WITH ALL PRIVILEGES`},
+		{`set password for "jdoe" = 'secret'`, `set password for "jdoe" = [REDACTED]`},
+		{`CREATE USER a WITH PASSWORD 'x'; SET PASSWORD FOR a = 'y'`, `CREATE USER a WITH PASSWORD [REDACTED]; SET PASSWORD FOR a = [REDACTED]`},
+		{`select password from users where name = 'secret'`, `select password from users where name = 'secret'`},
+		{`select * from cpu where host = 'a'`, `select * from cpu where host = 'a'`},
+	}
+	for _, tt := range tests {
+		if got := RedactPassword(tt[0]); got != tt[1] {
+			t.Errorf("redacted wrong: %s != %s", got, tt[1])
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package backend
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+	jsoniter "github.com/json-iterator/go"
+
+	"github.com/RedTimeDB/RedTimeProxy/util"
+)
+
+// intoJSON keeps the numbers of result as json.Number so that integers of integer fields are written back exactly
+var intoJSON = jsoniter.Config{UseNumber: true}.Froze()
+
+var ErrIntoTarget = errors.New("can't get target measurement of into clause")
+
+// CheckSelectIntoFromTokens checks if the query is a select statement with into clause
+func CheckSelectIntoFromTokens(tokens []string) bool {
+	if strings.ToLower(tokens[0]) != "select" {
+		return false
+	}
+	for i := 2; i < len(tokens); i++ {
+		switch strings.ToLower(tokens[i]) {
+		case "into":
+			return true
+		case "from":
+			return false
+		}
+	}
+	return false
+}
+
+// SplitSelectInto removes the into clause from query, and returns the target database, retention policy and measurement,
+// the measurement is empty if the target is the :MEASUREMENT backreference, the into and from keywords are matched
+// on the lexemes of query, so quoted identifiers and strings are left as is
+func SplitSelectInto(q string) (sq, db, rp, meas string, err error) {
+	lexemes := ScanLexemes(q)
+	into, from := -1, -1
+	for i := 1; i+1 < len(lexemes) && from < 0; i++ {
+		if !isSpace(lexemes[i-1][0]) || !isSpace(lexemes[i+1][0]) {
+			continue
+		}
+		switch {
+		case into < 0 && strings.EqualFold(lexemes[i], "into"):
+			into = i
+		case into >= 0 && i > into+2 && strings.EqualFold(lexemes[i], "from"):
+			from = i
+		}
+	}
+	if from < 0 {
+		return "", "", "", "", ErrIntoTarget
+	}
+	target := strings.Join(lexemes[into+2:from-1], "")
+	sq = strings.Join(lexemes[:into-1], "") + " from " + strings.Join(lexemes[from+2:], "")
+
+	segments, err := splitIdentifier(target)
+	if err != nil {
+		return "", "", "", "", err
+	}
+	switch len(segments) {
+	case 1:
+		meas = segments[0]
+	case 2:
+		rp, meas = segments[0], segments[1]
+	case 3:
+		db, rp, meas = segments[0], segments[1], segments[2]
+	default:
+		return "", "", "", "", ErrIntoTarget
+	}
+	if strings.EqualFold(meas, ":measurement") {
+		meas = ""
+	} else if meas == "" {
+		return "", "", "", "", ErrIntoTarget
+	}
+	return
+}
+
+// splitIdentifier splits the segmented identifier like "db"."rp"."meas" by dots outside quotes
+func splitIdentifier(s string) (segments []string, err error) {
+	var seg strings.Builder
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && quoted && i+1 < len(s):
+			i++
+			seg.WriteByte(s[i])
+		case c == '"':
+			quoted = !quoted
+		case c == '.' && !quoted:
+			segments = append(segments, seg.String())
+			seg.Reset()
+		default:
+			seg.WriteByte(c)
+		}
+	}
+	if quoted {
+		return nil, ErrUnmatchedQuote
+	}
+	return append(segments, seg.String()), nil
+}
+
+// selectInto runs the select part on the backends of source measurement, and writes the result rows
+// through the proxy, so that the target measurement lands on its own backends in all circles
+func (ip *Proxy) selectInto(w http.ResponseWriter, req *http.Request, tokens []string, db string) (body []byte, err error) {
+	q := strings.TrimSpace(req.FormValue("q"))
+	sq, targetDb, targetRp, targetMeas, err := SplitSelectInto(q)
+	if err != nil {
+		return nil, err
+	}
+	if targetDb == "" {
+		targetDb = db
+	}
+	if len(ip.DBSet) > 0 && !ip.DBSet[targetDb] {
+		return nil, fmt.Errorf("database forbidden: %s", targetDb)
+	}
+	meas, err := GetMeasurementFromTokens(tokens)
+	if err != nil {
+		return nil, ErrGetMeasurement
+	}
+
+	series, err := ip.querySeries(req, db, meas, sq)
+	if err != nil {
+		return nil, err
+	}
+	written := 0
+	fieldTypes := make(map[string]map[string]string)
+	for _, row := range series {
+		name := targetMeas
+		if name == "" {
+			name = row.Name
+		}
+		if _, ok := fieldTypes[name]; !ok {
+			fieldTypes[name] = ip.getFieldTypes(targetDb, name)
+		}
+		p, n := rowToLines(name, row, fieldTypes[name])
+		if n == 0 {
+			continue
+		}
+		if err = ip.Write(p, targetDb, targetRp, "ns"); err != nil {
+			return nil, err
+		}
+		written += n
+	}
+
+	rsp := ResponseFromSeries(models.Rows{{
+		Name:    "result",
+		Columns: []string{"time", "written"},
+		Values:  [][]interface{}{{time.Unix(0, 0).UTC().Format(time.RFC3339), written}},
+	}})
+	contentType := GetContentType(req)
+	w.Header().Set("Content-Type", contentType)
+	return MarshalResponse(rsp, contentType, req.FormValue("pretty") == "true"), nil
+}
+
+// querySeries queries the backend of measurement, or all backends of a circle if measurement is a regex
+func (ip *Proxy) querySeries(req *http.Request, db, meas, q string) (series models.Rows, err error) {
+	sreq := NewQueryRequest("POST", db, q).WithContext(req.Context())
+	if rp := req.FormValue("rp"); rp != "" {
+		sreq.Form.Set("rp", rp)
+	}
+	key := GetKey(db, meas)
+	for _, circle := range ip.readableCircles() {
+		var backends []*Backend
+		if meas[0] == '/' {
+			if !circle.CheckActive() {
+				continue
+			}
+			backends = circle.Backends
+		} else if be := circle.GetBackend(key); be.IsActive() {
+			backends = []*Backend{be}
+		} else {
+			continue
+		}
+		recordRoute(req.Context(), circle, backends...)
+		var qrs []*QueryResult
+		qrs, _, err = QueryResultsInParallel(backends, sreq, nil, true)
+		series = nil
+		for _, qr := range qrs {
+			if err = statementError(qr.Body); err != nil {
+				break
+			}
+			rsp := &Response{}
+			if err = intoJSON.Unmarshal(qr.Body, rsp); err != nil {
+				break
+			}
+			if len(rsp.Results) > 0 {
+				series = append(series, rsp.Results[0].Series...)
+			}
+		}
+		if err == nil || req.Context().Err() != nil {
+			return
+		}
+	}
+	if err == nil {
+		err = ErrBackendsUnavailable
+	}
+	return
+}
+
+// getFieldTypes returns the field types of an existing measurement, which decide the types of written numbers
+func (ip *Proxy) getFieldTypes(db, meas string) map[string]string {
+	fieldMap := make(map[string]string)
+	key := GetKey(db, meas)
+	for _, circle := range ip.readableCircles() {
+		be := circle.GetBackend(key)
+		if !be.IsActive() {
+			continue
+		}
+		for field, types := range be.GetFieldKeys(db, meas) {
+			typeSet := util.NewSetFromSlice(types)
+			for _, dt := range FieldTypes {
+				if typeSet[dt] {
+					fieldMap[field] = dt
+					break
+				}
+			}
+		}
+		break
+	}
+	return fieldMap
+}
+
+// rowToLines converts the result row to line protocol, tags of row are kept as tags and columns become fields,
+// numbers are written as the type of existing field, otherwise as floats like select into of influxdb
+func rowToLines(meas string, row *models.Row, fieldTypes map[string]string) ([]byte, int) {
+	var buf bytes.Buffer
+	n := 0
+	for _, value := range row.Values {
+		if line, ok := RowLine(meas, row.Tags, row.Columns, value, nil, fieldTypes); ok {
+			buf.Write(line)
+			n++
+		}
+	}
+	return buf.Bytes(), n
+}
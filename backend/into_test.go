@@ -0,0 +1,64 @@
+package backend
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func TestSplitSelectInto(t *testing.T) {
+	tests := []struct {
+		q    string
+		sq   string
+		db   string
+		rp   string
+		meas string
+	}{
+		{"SELECT * INTO \"copy\" FROM \"cpu\"", "SELECT * from \"cpu\"", "", "", "copy"},
+		{"select mean(value) into cpu_1h from cpu group by time(1h)", "select mean(value) from cpu group by time(1h)", "", "", "cpu_1h"},
+		{"SELECT * INTO \"other\"..\"cpu.copy\" FROM cpu", "SELECT * from cpu", "other", "", "cpu.copy"},
+		{"SELECT * INTO \"db\".\"rp\".\"m\" FROM cpu", "SELECT * from cpu", "db", "rp", "m"},
+		{"SELECT mean(\"value\") INTO \"cpu_1h\".:MEASUREMENT FROM /cpu.*/", "SELECT mean(\"value\") from /cpu.*/", "", "cpu_1h", ""},
+		{"select \"a into b from c\" into copy from cpu", "select \"a into b from c\" from cpu", "", "", "copy"},
+		{"SELECT * INTO \"into x from\" FROM cpu WHERE a = ' from '", "SELECT * from cpu WHERE a = ' from '", "", "", "into x from"},
+	}
+	for _, tt := range tests {
+		sq, db, rp, meas, err := SplitSelectInto(tt.q)
+		if err != nil || sq != tt.sq || db != tt.db || rp != tt.rp || meas != tt.meas {
+			t.Errorf("split %s wrong: %q %q %q %q %v", tt.q, sq, db, rp, meas, err)
+		}
+	}
+	if !CheckSelectIntoFromTokens(ScanTokens("SELECT * INTO copy FROM cpu", 0)) {
+		t.Errorf("select into not detected")
+	}
+	if CheckSelectIntoFromTokens(ScanTokens("SELECT * FROM cpu", 0)) {
+		t.Errorf("select detected as select into")
+	}
+}
+
+func TestRowToLines(t *testing.T) {
+	row := &models.Row{
+		Name:    "cpu",
+		Tags:    map[string]string{"host": "server 1", "region": ""},
+		Columns: []string{"time", "mean", "count", "last", "up"},
+		Values: [][]interface{}{
+			{"2020-01-01T00:00:00Z", json.Number("1.5"), json.Number("3"), "a\"b", true},
+			{"2020-01-01T01:00:00Z", json.Number("2"), nil, nil, nil},
+			{"2020-01-01T02:00:00Z", nil, nil, nil, nil},
+		},
+	}
+	p, n := rowToLines("cpu_1h", row, map[string]string{"count": "integer"})
+	want := "cpu_1h,host=server\\ 1 mean=1.5,count=3i,last=\"a\\\"b\",up=true 1577836800000000000\n" +
+		"cpu_1h,host=server\\ 1 mean=2 1577840400000000000\n"
+	if n != 2 || string(p) != want {
+		t.Errorf("lines wrong: %d\n%s", n, p)
+	}
+	// numbers of unknown type are floats, so mean=2 and mean=2.5 don't conflict
+	p, _ = rowToLines("cpu_1h", row, nil)
+	want = "cpu_1h,host=server\\ 1 mean=1.5,count=3,last=\"a\\\"b\",up=true 1577836800000000000\n" +
+		"cpu_1h,host=server\\ 1 mean=2 1577840400000000000\n"
+	if string(p) != want {
+		t.Errorf("lines wrong:\n%s", p)
+	}
+}
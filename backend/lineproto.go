@@ -2,16 +2,22 @@ package backend
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/influxdata/influxdb1-client/models"
+
+	"github.com/RedTimeDB/RedTimeProxy/util"
 )
 
 type LinePoint struct {
 	Db   string
+	Rp   string
 	Line []byte
 }
 
@@ -80,6 +86,13 @@ func BytesToInt64(buf []byte) int64 {
 	return res
 }
 
+// CheckLine checks the line like WriteRow does, line isn't modified
+func CheckLine(line []byte, precision string) bool {
+	nanoLine := AppendNano(append([]byte(nil), line...), precision)
+	meas, err := ScanKey(nanoLine)
+	return err == nil && RapidCheck(nanoLine[len(meas):])
+}
+
 func RapidCheck(buf []byte) bool {
 	buflen := len(buf)
 	// find the first unescaped space, and pick the last for consecutive spaces
@@ -113,3 +126,89 @@ Loop:
 	}
 	return j-i > 3
 }
+
+// FieldString returns the field of value in line protocol as the field type, numbers of unknown type are floats
+// like select into of influxdb, it's false if value is nil or mismatches the field type
+func FieldString(k string, v interface{}, vtype string) (string, bool) {
+	k = util.EscapeTag(k)
+	switch v := v.(type) {
+	case json.Number:
+		switch vtype {
+		case "", "float":
+			return fmt.Sprintf("%s=%s", k, v), true
+		case "integer":
+			if !strings.ContainsAny(string(v), ".eE") {
+				return fmt.Sprintf("%s=%si", k, v), true
+			}
+			if f, err := strconv.ParseFloat(string(v), 64); err == nil {
+				return fmt.Sprintf("%s=%di", k, int64(f)), true
+			}
+		}
+	case float64:
+		switch vtype {
+		case "", "float":
+			return fmt.Sprintf("%s=%v", k, v), true
+		case "integer":
+			return fmt.Sprintf("%s=%di", k, int64(v)), true
+		}
+	case string:
+		if vtype == "" || vtype == "string" {
+			return fmt.Sprintf("%s=\"%s\"", k, models.EscapeStringField(v)), true
+		}
+	case bool:
+		if vtype == "" || vtype == "boolean" {
+			return fmt.Sprintf("%s=%t", k, v), true
+		}
+	}
+	return "", false
+}
+
+// RowLine converts the value of result row to a line, columns in tagSet are tags and the others are fields
+// in the types of fieldTypes, the first column is the RFC3339 time, it's false if the row has no fields or invalid time
+func RowLine(meas string, tags map[string]string, columns []string, value []interface{}, tagSet util.Set, fieldTypes map[string]string) ([]byte, bool) {
+	if len(value) < 2 {
+		return nil, false
+	}
+	ts, ok := value[0].(string)
+	if !ok {
+		return nil, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return nil, false
+	}
+
+	rowTags := make(map[string]string, len(tags))
+	for k, v := range tags {
+		rowTags[k] = v
+	}
+	fieldSet := make([]string, 0, len(value)-1)
+	for i := 1; i < len(value) && i < len(columns); i++ {
+		k := columns[i]
+		if tagSet[k] {
+			if v, ok := value[i].(string); ok {
+				rowTags[k] = v
+			}
+			continue
+		}
+		if field, ok := FieldString(k, value[i], fieldTypes[k]); ok {
+			fieldSet = append(fieldSet, field)
+		}
+	}
+	if len(fieldSet) == 0 {
+		return nil, false
+	}
+
+	keys := make([]string, 0, len(rowTags))
+	for k := range rowTags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	mtagSet := []string{util.EscapeMeasurement(meas)}
+	for _, k := range keys {
+		if rowTags[k] != "" {
+			mtagSet = append(mtagSet, fmt.Sprintf("%s=%s", util.EscapeTag(k), util.EscapeTag(rowTags[k])))
+		}
+	}
+	return []byte(fmt.Sprintf("%s %s %d\n", strings.Join(mtagSet, ","), strings.Join(fieldSet, ","), t.UnixNano())), true
+}
@@ -6,6 +6,8 @@ import (
 	"io"
 	"strings"
 	"testing"
+
+	"github.com/RedTimeDB/RedTimeProxy/util"
 )
 
 func TestScanKey(t *testing.T) {
@@ -344,6 +346,22 @@ func TestRapidCheck(t *testing.T) {
 	}
 }
 
+func TestCheckLine(t *testing.T) {
+	buf := []byte("cpu,host=a value=1 1596819659\ncpu value=2")
+	lines := bytes.Split(buf, []byte("\n"))
+	if !CheckLine(lines[0], "s") || !CheckLine(lines[1], "ns") {
+		t.Errorf("valid lines failed")
+	}
+	if string(buf) != "cpu,host=a value=1 1596819659\ncpu value=2" {
+		t.Errorf("buffer modified: %s", buf)
+	}
+	for _, line := range []string{"cpu,host=a", "cpu", "cpu,host=a  "} {
+		if CheckLine([]byte(line), "ns") {
+			t.Errorf("line %q should be invalid", line)
+		}
+	}
+}
+
 func BenchmarkRapidCheck(b *testing.B) {
 	buf := &bytes.Buffer{}
 	for i := 0; i < b.N; i++ {
@@ -370,3 +388,19 @@ func BenchmarkRapidCheck(b *testing.B) {
 		RapidCheck(line)
 	}
 }
+
+func TestRowLine(t *testing.T) {
+	columns := []string{"time", "host", "idle", "count", "up"}
+	tagSet := util.NewSetFromSlice([]string{"host"})
+	fieldTypes := map[string]string{"idle": "float", "count": "integer", "up": "boolean"}
+	line, ok := RowLine("cpu", nil, columns, []interface{}{"2020-01-01T00:00:00Z", "server 1", float64(2), float64(3), true}, tagSet, fieldTypes)
+	if want := "cpu,host=server\\ 1 idle=2,count=3i,up=true 1577836800000000000\n"; !ok || string(line) != want {
+		t.Errorf("line wrong: %q", line)
+	}
+	if _, ok = RowLine("cpu", nil, columns, []interface{}{"2020-01-01T00:00:00Z", "server 1", nil, nil, nil}, tagSet, fieldTypes); ok {
+		t.Error("row without fields should be skipped")
+	}
+	if _, ok = RowLine("cpu", nil, columns, []interface{}{"invalid", "server 1", float64(2), nil, nil}, tagSet, fieldTypes); ok {
+		t.Error("row of invalid time should be skipped")
+	}
+}
@@ -0,0 +1,345 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+var (
+	ErrMQTTInvalidPayload = errors.New("mqtt json payload must be an object or an array of objects")
+	ErrMQTTNoFields       = errors.New("mqtt payload has no fields")
+)
+
+// MQTTFormatJSON and MQTTFormatLine are the payload formats of mqtt subscription
+const (
+	MQTTFormatJSON = "json"
+	MQTTFormatLine = "line"
+)
+
+// mqttTimeUnits are the time formats of numeric timestamps, the other time formats are go layouts
+var mqttTimeUnits = map[string]int64{
+	"unix":    int64(time.Second),
+	"unix_ms": int64(time.Millisecond),
+	"unix_us": int64(time.Microsecond),
+	"unix_ns": int64(time.Nanosecond),
+}
+
+// TopicMeasurement and TopicMetric are the template segments whose topic segments are the measurement
+const (
+	TopicMeasurement = "measurement"
+	TopicMetric      = "metric"
+)
+
+// TopicTemplate extracts the measurement and tags from the segments of mqtt topic,
+// like site/+site/device/+id/metric, segment +name is the tag name, segment measurement or metric is the measurement,
+// multiple measurement segments are joined by "_", and the other segments are skipped
+type TopicTemplate struct {
+	segments []string
+}
+
+func NewTopicTemplate(template string) *TopicTemplate {
+	if template == "" {
+		return &TopicTemplate{}
+	}
+	return &TopicTemplate{segments: strings.Split(template, "/")}
+}
+
+// Apply returns the measurement and tags of topic, measurement is the topic itself if template is empty or
+// has no measurement segment, the topic segments beyond template are skipped
+func (tt *TopicTemplate) Apply(topic string) (measurement string, tags map[string]string) {
+	tags = make(map[string]string)
+	var parts []string
+	for i, segment := range strings.Split(topic, "/") {
+		if i >= len(tt.segments) {
+			break
+		}
+		tmpl := tt.segments[i]
+		switch {
+		case tmpl == TopicMeasurement || tmpl == TopicMetric:
+			parts = append(parts, segment)
+		case len(tmpl) > 1 && tmpl[0] == '+' && segment != "":
+			tags[tmpl[1:]] = segment
+		}
+	}
+	if len(parts) == 0 {
+		return topic, tags
+	}
+	return strings.Join(parts, "_"), tags
+}
+
+// MQTTParser converts the payloads of mqtt subscription to line protocol
+type MQTTParser struct {
+	sub      *MQTTSubscription
+	template *TopicTemplate
+	fields   map[string][]string
+	tags     map[string][]string
+	time     []string
+}
+
+func NewMQTTParser(sub *MQTTSubscription) (mp *MQTTParser, err error) {
+	mp = &MQTTParser{
+		sub:      sub,
+		template: NewTopicTemplate(sub.Template),
+		fields:   make(map[string][]string),
+		tags:     make(map[string][]string),
+	}
+	for name, path := range sub.Fields {
+		if mp.fields[name], err = parseJSONPath(path); err != nil {
+			return nil, err
+		}
+	}
+	for name, path := range sub.Tags {
+		if mp.tags[name], err = parseJSONPath(path); err != nil {
+			return nil, err
+		}
+	}
+	if sub.TimeKey != "" {
+		if mp.time, err = parseJSONPath(sub.TimeKey); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// Parse returns the lines of payload in the precision of subscription, the lines are checked if format is line,
+// or else the json object, or each object of json array, is a point, whose time is now if time key isn't set
+func (mp *MQTTParser) Parse(topic string, payload []byte, now time.Time) ([]byte, error) {
+	if mp.sub.Format == MQTTFormatLine {
+		return mp.parseLines(payload)
+	}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	var objs []interface{}
+	switch node := v.(type) {
+	case map[string]interface{}:
+		objs = []interface{}{node}
+	case []interface{}:
+		objs = node
+	default:
+		return nil, ErrMQTTInvalidPayload
+	}
+
+	measurement, tags := mp.template.Apply(topic)
+	var buf bytes.Buffer
+	for _, obj := range objs {
+		m, ok := obj.(map[string]interface{})
+		if !ok {
+			return nil, ErrMQTTInvalidPayload
+		}
+		pt, err := mp.point(measurement, tags, m, now)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(pt.PrecisionString(mp.sub.Precision))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func (mp *MQTTParser) parseLines(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, line := range bytes.Split(payload, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		if !CheckLine(line, mp.sub.Precision) {
+			return nil, fmt.Errorf("invalid line: %q", line)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if buf.Len() == 0 {
+		return nil, ErrMQTTNoFields
+	}
+	return buf.Bytes(), nil
+}
+
+// point selects the fields by paths, or flattens the whole object except the tag and time keys if no fields are set
+func (mp *MQTTParser) point(measurement string, topicTags map[string]string, m map[string]interface{}, now time.Time) (models.Point, error) {
+	tags := make(map[string]string, len(topicTags)+len(mp.tags))
+	for k, v := range topicTags {
+		tags[k] = v
+	}
+	for name, path := range mp.tags {
+		if v, ok := lookupJSONPath(m, path); ok {
+			if s := jsonTagValue(v); s != "" {
+				tags[name] = s
+			}
+		}
+	}
+
+	fields := make(models.Fields)
+	sep := mp.sub.Separator
+	if len(mp.fields) == 0 {
+		flattenJSON(fields, "", m, sep)
+		for _, path := range mp.tags {
+			delete(fields, strings.Join(path, sep))
+		}
+		if mp.time != nil {
+			delete(fields, strings.Join(mp.time, sep))
+		}
+	} else {
+		for name, path := range mp.fields {
+			if v, ok := lookupJSONPath(m, path); ok {
+				flattenJSON(fields, name, v, sep)
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return nil, ErrMQTTNoFields
+	}
+
+	t := now
+	if mp.time != nil {
+		v, ok := lookupJSONPath(m, mp.time)
+		if !ok {
+			return nil, fmt.Errorf("timestamp %s not found", mp.sub.TimeKey)
+		}
+		var err error
+		if t, err = parseMQTTTime(v, mp.sub.TimeFormat); err != nil {
+			return nil, err
+		}
+	}
+	return models.NewPoint(measurement, models.NewTags(tags), fields, t)
+}
+
+// parseJSONPath parses the path like $.sensor.values[0] or sensor['temp'] to keys and indexes
+func parseJSONPath(path string) (segments []string, err error) {
+	p := strings.TrimPrefix(path, "$")
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			continue
+		case '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid json path: %q, unterminated [", path)
+			}
+			seg := p[1:end]
+			if len(seg) >= 2 && (seg[0] == '\'' || seg[0] == '"') && seg[len(seg)-1] == seg[0] {
+				seg = seg[1 : len(seg)-1]
+			} else if _, err := strconv.Atoi(seg); err != nil {
+				return nil, fmt.Errorf("invalid json path: %q, require [index] or ['key']", path)
+			}
+			if seg == "" {
+				return nil, fmt.Errorf("invalid json path: %q, empty key", path)
+			}
+			segments = append(segments, seg)
+			p = p[end+1:]
+		default:
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			segments = append(segments, p[:end])
+			p = p[end:]
+		}
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("invalid json path: %q, empty path", path)
+	}
+	return
+}
+
+func lookupJSONPath(v interface{}, segments []string) (interface{}, bool) {
+	for _, seg := range segments {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			child, ok := node[seg]
+			if !ok {
+				return nil, false
+			}
+			v = child
+		case []interface{}:
+			idx, err := strconv.Atoi(seg)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, false
+			}
+			v = node[idx]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// flattenJSON adds the values of v to fields, nested keys and array indexes are joined by separator,
+// numbers are float fields and nulls are skipped
+func flattenJSON(fields models.Fields, prefix string, v interface{}, sep string) {
+	key := func(k string) string {
+		if prefix == "" {
+			return k
+		}
+		return prefix + sep + k
+	}
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for k, child := range node {
+			flattenJSON(fields, key(k), child, sep)
+		}
+	case []interface{}:
+		for i, child := range node {
+			flattenJSON(fields, key(strconv.Itoa(i)), child, sep)
+		}
+	case json.Number:
+		if f, err := node.Float64(); err == nil {
+			fields[prefix] = f
+		}
+	case string, bool:
+		fields[prefix] = node
+	}
+}
+
+func jsonTagValue(v interface{}) string {
+	switch node := v.(type) {
+	case string:
+		return node
+	case json.Number:
+		return string(node)
+	case bool:
+		return strconv.FormatBool(node)
+	}
+	return ""
+}
+
+// parseMQTTTime parses the timestamp by time format, unix, unix_ms, unix_us and unix_ns are numeric timestamps,
+// which can be numbers or strings, the others are go layouts like 2006-01-02T15:04:05Z07:00
+func parseMQTTTime(v interface{}, format string) (time.Time, error) {
+	var s string
+	switch node := v.(type) {
+	case json.Number:
+		s = string(node)
+	case string:
+		s = node
+	default:
+		return time.Time{}, fmt.Errorf("invalid timestamp: %v", v)
+	}
+	if format == "" {
+		format = "unix"
+	}
+	unit, ok := mqttTimeUnits[format]
+	if !ok {
+		return time.Parse(format, s)
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(0, n*unit), nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp: %q", s)
+	}
+	return time.Unix(0, int64(f*float64(unit))), nil
+}
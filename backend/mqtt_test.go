@@ -0,0 +1,100 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTopicTemplate(t *testing.T) {
+	tests := []struct {
+		template    string
+		topic       string
+		measurement string
+		tags        map[string]string
+	}{
+		{"plant/+plant/line/+line/measurement", "plant/3/line/7/temperature", "temperature", map[string]string{"plant": "3", "line": "7"}},
+		{"site/+site/device/+id/metric", "site/north/device/d1/humidity", "humidity", map[string]string{"site": "north", "id": "d1"}},
+		{"+host/measurement/measurement", "h1/cpu/idle", "cpu_idle", map[string]string{"host": "h1"}},
+		{"+plant/measurement", "3/temperature/extra", "temperature", map[string]string{"plant": "3"}},
+		{"+plant/+line/measurement", "3", "3", map[string]string{"plant": "3"}},
+		{"", "plant/3/temperature", "plant/3/temperature", map[string]string{}},
+	}
+	for _, tt := range tests {
+		measurement, tags := NewTopicTemplate(tt.template).Apply(tt.topic)
+		if measurement != tt.measurement || !reflect.DeepEqual(tags, tt.tags) {
+			t.Errorf("template %q of topic %q: got %q %v, want %q %v", tt.template, tt.topic, measurement, tags, tt.measurement, tt.tags)
+		}
+	}
+}
+
+func TestMQTTParser(t *testing.T) {
+	now := time.Unix(100, 0)
+	tests := []struct {
+		sub     MQTTSubscription
+		topic   string
+		payload string
+		lines   string
+	}{
+		{
+			MQTTSubscription{Template: "plant/+plant/line/+line/measurement"},
+			"plant/3/line/7/temperature", `{"value": 21.5, "unit": "C", "ok": true, "missing": null}`,
+			"temperature,line=7,plant=3 ok=true,unit=\"C\",value=21.5 100000000000\n",
+		},
+		{
+			MQTTSubscription{},
+			"sensors", `{"env": {"temp": 20, "hum": [40, 41]}}`,
+			"sensors env_hum_0=40,env_hum_1=41,env_temp=20 100000000000\n",
+		},
+		{
+			MQTTSubscription{Precision: "s", Tags: map[string]string{"device": "$.meta.id"}, TimeKey: "$.ts"},
+			"sensors", `[{"meta": {"id": 5}, "ts": 1600000000, "v": 1}, {"meta": {"id": "d6"}, "ts": "1600000001", "v": 2}]`,
+			"sensors,device=5 v=1 1600000000\nsensors,device=d6 v=2 1600000001\n",
+		},
+		{
+			MQTTSubscription{Fields: map[string]string{"temp": "$.data.values[1]"}, Tags: map[string]string{"room": "data['room']"}, TimeKey: "time", TimeFormat: "2006-01-02T15:04:05Z07:00"},
+			"sensors", `{"time": "2020-09-13T12:26:40Z", "data": {"room": "r1", "values": [1, 2.5]}}`,
+			"sensors,room=r1 temp=2.5 1600000000000000000\n",
+		},
+		{
+			MQTTSubscription{Precision: "ms", TimeKey: "ts", TimeFormat: "unix_ms"},
+			"sensors", `{"ts": 1600000000123, "v": 1}`,
+			"sensors v=1 1600000000123\n",
+		},
+		{
+			MQTTSubscription{Format: MQTTFormatLine, Precision: "s"},
+			"sensors", "cpu,host=a value=1 1600000000\n\n# comment\nmem value=2\n",
+			"cpu,host=a value=1 1600000000\nmem value=2\n",
+		},
+	}
+	for _, tt := range tests {
+		tt.sub.Topic = tt.topic
+		if tt.sub.Separator == "" {
+			tt.sub.Separator = "_"
+		}
+		mp, err := NewMQTTParser(&tt.sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines, err := mp.Parse(tt.topic, []byte(tt.payload), now)
+		if err != nil || string(lines) != tt.lines {
+			t.Errorf("payload %s: got %q %v, want %q", tt.payload, lines, err, tt.lines)
+		}
+	}
+
+	mp, _ := NewMQTTParser(&MQTTSubscription{Separator: "_", TimeKey: "ts"})
+	for _, payload := range []string{`{"a": 1`, `1`, `[1]`, `{"ts": 1}`, `{"a": 1}`, `{"a": 1, "ts": "x"}`} {
+		if _, err := mp.Parse("sensors", []byte(payload), now); err == nil {
+			t.Errorf("payload %s should fail", payload)
+		}
+	}
+	mp, _ = NewMQTTParser(&MQTTSubscription{Format: MQTTFormatLine})
+	if _, err := mp.Parse("sensors", []byte("cpu value=1\ncpu"), now); err == nil {
+		t.Error("invalid line should fail")
+	}
+	for _, path := range []string{"$", "a[0", "a[x]", "a['']"} {
+		if _, err := NewMQTTParser(&MQTTSubscription{Fields: map[string]string{"f": path}}); err == nil {
+			t.Errorf("json path %q should be invalid", path)
+		}
+	}
+}
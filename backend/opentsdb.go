@@ -0,0 +1,88 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+	jsoniter "github.com/json-iterator/go"
+)
+
+var ErrOpenTSDBInvalidPut = errors.New("invalid put, require put <metric> <timestamp> <value> <tagk=tagv ...>")
+
+// OpenTSDBFieldName is the field which all opentsdb values are written to
+const OpenTSDBFieldName = "value"
+
+// OpenTSDBPoint is a data point of opentsdb /api/put
+type OpenTSDBPoint struct {
+	Metric    string            `json:"metric"`
+	Timestamp int64             `json:"timestamp"`
+	Value     json.Number       `json:"value"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// Line converts the point to line protocol, metric is the measurement
+func (pt *OpenTSDBPoint) Line() ([]byte, error) {
+	if pt.Metric == "" {
+		return nil, errors.New("metric cannot be empty")
+	}
+	value, err := strconv.ParseFloat(string(pt.Value), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value: %q", pt.Value)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("invalid value: %q, NaN or Inf is not supported", pt.Value)
+	}
+	p, err := models.NewPoint(pt.Metric, models.NewTags(pt.Tags), models.Fields{OpenTSDBFieldName: value}, openTSDBTime(pt.Timestamp))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(p.String()), nil
+}
+
+// openTSDBTime returns the time of timestamp in seconds, or in milliseconds if it's larger than 10 digits
+func openTSDBTime(ts int64) time.Time {
+	if ts > 9999999999 {
+		return time.Unix(0, ts*int64(time.Millisecond))
+	}
+	return time.Unix(ts, 0)
+}
+
+// ParseOpenTSDBPut parses the telnet line "put <metric> <timestamp> <value> <tagk1=tagv1 ...>"
+func ParseOpenTSDBPut(line string) (*OpenTSDBPoint, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || fields[0] != "put" {
+		return nil, ErrOpenTSDBInvalidPut
+	}
+	ts, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %q", fields[2])
+	}
+	pt := &OpenTSDBPoint{Metric: fields[1], Timestamp: ts, Value: json.Number(fields[3]), Tags: make(map[string]string)}
+	for _, kv := range fields[4:] {
+		idx := strings.IndexByte(kv, '=')
+		if idx <= 0 || idx == len(kv)-1 {
+			return nil, fmt.Errorf("invalid tag: %q, require tagk=tagv", kv)
+		}
+		pt.Tags[kv[:idx]] = kv[idx+1:]
+	}
+	return pt, nil
+}
+
+// ParseOpenTSDBJSON parses the body of /api/put, which is a data point or an array of data points
+func ParseOpenTSDBJSON(b []byte) (points []*OpenTSDBPoint, err error) {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '{' {
+		pt := &OpenTSDBPoint{}
+		err = jsoniter.Unmarshal(b, pt)
+		return []*OpenTSDBPoint{pt}, err
+	}
+	err = jsoniter.Unmarshal(b, &points)
+	return
+}
@@ -0,0 +1,60 @@
+package backend
+
+import (
+	"testing"
+)
+
+func TestParseOpenTSDBPut(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"put sys.cpu.user 1577836800 42.5 host=web01 cpu=0", "sys.cpu.user,cpu=0,host=web01 value=42.5 1577836800000000000"},
+		{"put sys.cpu.user 1577836800123 7 host=web01", "sys.cpu.user,host=web01 value=7 1577836800123000000"},
+		{"put mem 1577836800 1", "mem value=1 1577836800000000000"},
+	}
+	for _, tt := range tests {
+		pt, err := ParseOpenTSDBPut(tt.line)
+		if err != nil {
+			t.Errorf("line %q parse error: %s", tt.line, err)
+			continue
+		}
+		if p, err := pt.Line(); err != nil || string(p) != tt.want {
+			t.Errorf("line %q converted wrong: %s %v", tt.line, p, err)
+		}
+	}
+
+	for _, line := range []string{"put mem 1577836800", "get mem 1577836800 1", "put mem x 1", "put mem 1577836800 1 host"} {
+		if _, err := ParseOpenTSDBPut(line); err == nil {
+			t.Errorf("line %q should fail", line)
+		}
+	}
+	for _, line := range []string{"put mem 1577836800 x", "put mem 1577836800 NaN"} {
+		if pt, err := ParseOpenTSDBPut(line); err != nil {
+			t.Errorf("line %q parse error: %s", line, err)
+		} else if _, err = pt.Line(); err == nil {
+			t.Errorf("line %q should fail on value", line)
+		}
+	}
+}
+
+func TestParseOpenTSDBJSON(t *testing.T) {
+	points, err := ParseOpenTSDBJSON([]byte(`{"metric":"sys.cpu.nice","timestamp":1577836800,"value":18,"tags":{"host":"web01","dc":"lga"}}`))
+	if err != nil || len(points) != 1 {
+		t.Fatalf("single point decoded wrong: %v", err)
+	}
+	if p, err := points[0].Line(); err != nil || string(p) != "sys.cpu.nice,dc=lga,host=web01 value=18 1577836800000000000" {
+		t.Errorf("single point converted wrong: %s %v", p, err)
+	}
+
+	points, err = ParseOpenTSDBJSON([]byte(` [{"metric":"a","timestamp":1577836800000,"value":1.5,"tags":{"host":"x"}},{"metric":"","timestamp":1,"value":1}]`))
+	if err != nil || len(points) != 2 {
+		t.Fatalf("points decoded wrong: %v", err)
+	}
+	if p, err := points[0].Line(); err != nil || string(p) != "a,host=x value=1.5 1577836800000000000" {
+		t.Errorf("point converted wrong: %s %v", p, err)
+	}
+	if _, err = points[1].Line(); err == nil {
+		t.Errorf("point without metric should fail")
+	}
+}
@@ -0,0 +1,191 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RedTimeDB/RedTimeProxy/util"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+var (
+	ErrPromNoMetricName   = errors.New("remote read requires a matcher of metric name")
+	ErrPromInvalidMatcher = errors.New("invalid label matcher type")
+)
+
+const (
+	// PromMetricNameLabel is the label of prometheus metric name, which is the measurement of points
+	PromMetricNameLabel = "__name__"
+	// PromMeasurementName is the measurement used if no metric name is found on write
+	PromMeasurementName = "prom_metric_not_specified"
+	// PromFieldName is the field which all prometheus values are written to
+	PromFieldName = "value"
+)
+
+// PromWriteRequestToLines converts the time series of remote write request to line protocol, the same way as influxdb 1.8,
+// samples of NaN or Inf are dropped
+func PromWriteRequestToLines(req *PromWriteRequest) (p []byte, dropped int, err error) {
+	var buf bytes.Buffer
+	for _, ts := range req.Timeseries {
+		measurement := PromMeasurementName
+		tags := make(map[string]string, len(ts.Labels))
+		for _, l := range ts.Labels {
+			tags[l.Name] = l.Value
+			if l.Name == PromMetricNameLabel {
+				measurement = l.Value
+			}
+		}
+		for _, s := range ts.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				dropped++
+				continue
+			}
+			t := time.Unix(0, s.Timestamp*int64(time.Millisecond))
+			pt, err := models.NewPoint(measurement, models.NewTags(tags), models.Fields{PromFieldName: s.Value}, t)
+			if err != nil {
+				return nil, dropped, err
+			}
+			buf.WriteString(pt.String())
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes(), dropped, nil
+}
+
+// PromQueryToInfluxQL translates the label matchers and time range of remote read query to influxql, the same way as
+// influxdb 1.8, metric name is the measurement and other matchers are tag conditions
+func PromQueryToInfluxQL(q *PromQuery, rp string) (meas, influxql string, err error) {
+	var conds []string
+	for _, m := range q.Matchers {
+		if m.Name == PromMetricNameLabel {
+			switch m.Type {
+			case PromMatchEqual:
+				meas = m.Value
+				continue
+			case PromMatchRegexp:
+				meas = promRegex(m.Value)
+				continue
+			}
+		}
+		cond, err := promCondition(m)
+		if err != nil {
+			return "", "", err
+		}
+		conds = append(conds, cond)
+	}
+	if meas == "" {
+		return "", "", ErrPromNoMetricName
+	}
+	source := meas
+	if meas[0] != '/' {
+		source = quoteIdentifier(meas)
+	}
+	if rp != "" {
+		source = quoteIdentifier(rp) + "." + source
+	}
+	conds = append(conds, fmt.Sprintf("time >= %dms AND time <= %dms", q.StartTimestampMs, q.EndTimestampMs))
+	influxql = fmt.Sprintf("SELECT %s FROM %s WHERE %s GROUP BY *", quoteIdentifier(PromFieldName), source, strings.Join(conds, " AND "))
+	return
+}
+
+func promCondition(m *PromLabelMatcher) (string, error) {
+	name := quoteIdentifier(m.Name)
+	switch m.Type {
+	case PromMatchEqual:
+		return fmt.Sprintf("%s = %s", name, quoteString(m.Value)), nil
+	case PromMatchNotEqual:
+		return fmt.Sprintf("%s != %s", name, quoteString(m.Value)), nil
+	case PromMatchRegexp:
+		return fmt.Sprintf("%s =~ %s", name, promRegex(m.Value)), nil
+	case PromMatchNotRegexp:
+		return fmt.Sprintf("%s !~ %s", name, promRegex(m.Value)), nil
+	}
+	return "", ErrPromInvalidMatcher
+}
+
+// promRegex returns the influxql regex of prometheus regex, which is fully anchored
+func promRegex(re string) string {
+	return "/^(?:" + strings.ReplaceAll(re, "/", `\/`) + ")$/"
+}
+
+func quoteIdentifier(s string) string {
+	return `"` + util.EscapeIdentifier(s) + `"`
+}
+
+func quoteString(s string) string {
+	return "'" + util.EscapeString(s) + "'"
+}
+
+// SeriesToPromTimeSeries converts the series of remote read query to time series, tags are the labels
+func SeriesToPromTimeSeries(series models.Rows) (tss []*PromTimeSeries, err error) {
+	for _, row := range series {
+		ts := &PromTimeSeries{}
+		for name, value := range row.Tags {
+			if value != "" {
+				ts.Labels = append(ts.Labels, PromLabel{Name: name, Value: value})
+			}
+		}
+		if _, ok := row.Tags[PromMetricNameLabel]; !ok {
+			ts.Labels = append(ts.Labels, PromLabel{Name: PromMetricNameLabel, Value: row.Name})
+		}
+		sort.Slice(ts.Labels, func(i, j int) bool { return ts.Labels[i].Name < ts.Labels[j].Name })
+		for _, v := range row.Values {
+			if len(v) < 2 || v[1] == nil {
+				continue
+			}
+			s, ok := v[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid time: %v", v[0])
+			}
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return nil, err
+			}
+			n, ok := v[1].(json.Number)
+			if !ok {
+				return nil, fmt.Errorf("invalid value: %v", v[1])
+			}
+			value, err := n.Float64()
+			if err != nil {
+				return nil, err
+			}
+			ts.Samples = append(ts.Samples, PromSample{Value: value, Timestamp: t.UnixNano() / int64(time.Millisecond)})
+		}
+		tss = append(tss, ts)
+	}
+	return
+}
+
+// ReadPrometheus executes the queries of remote read request, each query is routed by the metric name like /query
+func (ip *Proxy) ReadPrometheus(req *http.Request, rr *PromReadRequest, db, rp string) (*PromReadResponse, error) {
+	if timeout := ip.getQueryTimeout(db); timeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	rsp := &PromReadResponse{Results: make([][]*PromTimeSeries, 0, len(rr.Queries))}
+	for _, q := range rr.Queries {
+		meas, influxql, err := PromQueryToInfluxQL(q, rp)
+		if err != nil {
+			return nil, err
+		}
+		series, err := ip.querySeries(req, db, meas, influxql)
+		if err != nil {
+			return nil, err
+		}
+		tss, err := SeriesToPromTimeSeries(series)
+		if err != nil {
+			return nil, err
+		}
+		rsp.Results = append(rsp.Results, tss)
+	}
+	return rsp, nil
+}
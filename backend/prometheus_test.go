@@ -0,0 +1,113 @@
+package backend
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func TestPromWriteRequestToLines(t *testing.T) {
+	wr := &PromWriteRequest{Timeseries: []*PromTimeSeries{
+		{
+			Labels:  []PromLabel{{PromMetricNameLabel, "up"}, {"job", "node exporter"}},
+			Samples: []PromSample{{1, 1577836800000}, {math.NaN(), 1577836801000}, {0.5, 1577836802000}},
+		},
+		{
+			Labels:  []PromLabel{{"job", "x"}},
+			Samples: []PromSample{{math.Inf(1), 1577836800000}, {2, 1577836800123}},
+		},
+	}}
+	req, err := UnmarshalPromWriteRequest(wr.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Timeseries) != 2 || len(req.Timeseries[0].Labels) != 2 || req.Timeseries[0].Samples[2].Value != 0.5 || req.Timeseries[1].Samples[1].Timestamp != 1577836800123 {
+		t.Fatalf("write request decoded wrong: %+v", req.Timeseries[0])
+	}
+
+	p, dropped, err := PromWriteRequestToLines(req)
+	want := "up,__name__=up,job=node\\ exporter value=1 1577836800000000000\n" +
+		"up,__name__=up,job=node\\ exporter value=0.5 1577836802000000000\n" +
+		"prom_metric_not_specified,job=x value=2 1577836800123000000\n"
+	if err != nil || dropped != 2 || string(p) != want {
+		t.Errorf("lines wrong: %d %v\n%s", dropped, err, p)
+	}
+}
+
+func TestPromQueryToInfluxQL(t *testing.T) {
+	rr := &PromReadRequest{Queries: []*PromQuery{
+		{
+			StartTimestampMs: 1577836800000,
+			EndTimestampMs:   1577840400000,
+			Matchers: []*PromLabelMatcher{
+				{PromMatchEqual, PromMetricNameLabel, "up"},
+				{PromMatchNotEqual, "job", "it's"},
+				{PromMatchRegexp, "instance", "a/.*"},
+				{PromMatchNotRegexp, "env", "dev|test"},
+			},
+		},
+		{Matchers: []*PromLabelMatcher{{PromMatchRegexp, PromMetricNameLabel, "node_.*"}}},
+		{Matchers: []*PromLabelMatcher{{PromMatchEqual, "job", "x"}}},
+		{Matchers: []*PromLabelMatcher{{PromMatchEqual, PromMetricNameLabel, "up"}, {9, "job", "x"}}},
+	}}
+	req, err := UnmarshalPromReadRequest(rr.Marshal())
+	if err != nil || len(req.Queries) != 4 || req.Queries[0].EndTimestampMs != 1577840400000 || *req.Queries[0].Matchers[2] != *rr.Queries[0].Matchers[2] {
+		t.Fatalf("read request decoded wrong: %v", err)
+	}
+
+	tests := []struct {
+		rp    string
+		meas  string
+		query string
+		err   error
+	}{
+		{"", "up", `SELECT "value" FROM "up" WHERE "job" != 'it\'s' AND "instance" =~ /^(?:a\/.*)$/ AND "env" !~ /^(?:dev|test)$/ AND time >= 1577836800000ms AND time <= 1577840400000ms GROUP BY *`, nil},
+		{"autogen", "/^(?:node_.*)$/", `SELECT "value" FROM "autogen"./^(?:node_.*)$/ WHERE time >= 0ms AND time <= 0ms GROUP BY *`, nil},
+		{"", "", "", ErrPromNoMetricName},
+		{"", "", "", ErrPromInvalidMatcher},
+	}
+	for i, tt := range tests {
+		meas, query, err := PromQueryToInfluxQL(req.Queries[i], tt.rp)
+		if meas != tt.meas || query != tt.query || err != tt.err {
+			t.Errorf("query %d translated wrong: %s, %s, %v", i, meas, query, err)
+		}
+	}
+}
+
+func TestSeriesToPromTimeSeries(t *testing.T) {
+	series := models.Rows{
+		{
+			Name:    "up",
+			Tags:    map[string]string{"job": "node", PromMetricNameLabel: "up", "env": ""},
+			Columns: []string{"time", "value"},
+			Values: [][]interface{}{
+				{"2020-01-01T00:00:00Z", json.Number("1")},
+				{"2020-01-01T00:00:00.123Z", nil},
+				{"2020-01-01T00:00:01.5Z", json.Number("0.5")},
+			},
+		},
+		{Name: "cpu", Columns: []string{"time", "value"}, Values: [][]interface{}{{"2020-01-01T00:00:00Z", json.Number("2")}}},
+	}
+	rsp := &PromReadResponse{}
+	tss, err := SeriesToPromTimeSeries(series)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Results = append(rsp.Results, tss)
+	rsp, err = UnmarshalPromReadResponse(rsp.Marshal())
+	if err != nil || len(rsp.Results) != 1 || len(rsp.Results[0]) != 2 {
+		t.Fatalf("read response decoded wrong: %v", err)
+	}
+	ts := rsp.Results[0][0]
+	if len(ts.Labels) != 2 || ts.Labels[0] != (PromLabel{PromMetricNameLabel, "up"}) || ts.Labels[1] != (PromLabel{"job", "node"}) {
+		t.Errorf("labels wrong: %v", ts.Labels)
+	}
+	if len(ts.Samples) != 2 || ts.Samples[0] != (PromSample{1, 1577836800000}) || ts.Samples[1] != (PromSample{0.5, 1577836801500}) {
+		t.Errorf("samples wrong: %v", ts.Samples)
+	}
+	if ts = rsp.Results[0][1]; len(ts.Labels) != 1 || ts.Labels[0].Value != "cpu" {
+		t.Errorf("metric name label wrong: %v", ts.Labels)
+	}
+}
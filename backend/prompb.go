@@ -0,0 +1,267 @@
+package backend
+
+import (
+	"errors"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The messages of prometheus remote storage protocol, only the fields used by proxy are decoded
+
+var ErrInvalidProtobuf = errors.New("invalid protobuf message")
+
+type PromLabel struct {
+	Name  string
+	Value string
+}
+
+type PromSample struct {
+	Value     float64
+	Timestamp int64
+}
+
+type PromTimeSeries struct {
+	Labels  []PromLabel
+	Samples []PromSample
+}
+
+type PromWriteRequest struct {
+	Timeseries []*PromTimeSeries
+}
+
+// consumeFields calls fn with the number, type and value of each field in message b,
+// value is the content of bytes field, or the raw bytes of other fields
+func consumeFields(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var v []byte
+		if typ == protowire.BytesType {
+			v, n = protowire.ConsumeBytes(b)
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n >= 0 {
+				v = b[:n]
+			}
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := fn(num, typ, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func UnmarshalPromWriteRequest(b []byte) (req *PromWriteRequest, err error) {
+	req = &PromWriteRequest{}
+	err = consumeFields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		ts, err := unmarshalPromTimeSeries(v)
+		if err != nil {
+			return err
+		}
+		req.Timeseries = append(req.Timeseries, ts)
+		return nil
+	})
+	return
+}
+
+func unmarshalPromTimeSeries(b []byte) (ts *PromTimeSeries, err error) {
+	ts = &PromTimeSeries{}
+	err = consumeFields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			var l PromLabel
+			err := consumeFields(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				if typ == protowire.BytesType {
+					switch num {
+					case 1:
+						l.Name = string(v)
+					case 2:
+						l.Value = string(v)
+					}
+				}
+				return nil
+			})
+			ts.Labels = append(ts.Labels, l)
+			return err
+		case 2:
+			var s PromSample
+			err := consumeFields(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				switch {
+				case num == 1 && typ == protowire.Fixed64Type:
+					x, _ := protowire.ConsumeFixed64(v)
+					s.Value = math.Float64frombits(x)
+				case num == 2 && typ == protowire.VarintType:
+					x, _ := protowire.ConsumeVarint(v)
+					s.Timestamp = int64(x)
+				}
+				return nil
+			})
+			ts.Samples = append(ts.Samples, s)
+			return err
+		}
+		return nil
+	})
+	return
+}
+
+func (ts *PromTimeSeries) appendProto(b []byte) []byte {
+	for _, l := range ts.Labels {
+		var lb []byte
+		lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.Name)
+		lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.Value)
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, lb)
+	}
+	for _, s := range ts.Samples {
+		var sb []byte
+		sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+		sb = protowire.AppendFixed64(sb, math.Float64bits(s.Value))
+		sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+		sb = protowire.AppendVarint(sb, uint64(s.Timestamp))
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, sb)
+	}
+	return b
+}
+
+func (req *PromWriteRequest) Marshal() (b []byte) {
+	for _, ts := range req.Timeseries {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, ts.appendProto(nil))
+	}
+	return
+}
+
+const (
+	PromMatchEqual = iota
+	PromMatchNotEqual
+	PromMatchRegexp
+	PromMatchNotRegexp
+)
+
+type PromLabelMatcher struct {
+	Type  int
+	Name  string
+	Value string
+}
+
+type PromQuery struct {
+	StartTimestampMs int64
+	EndTimestampMs   int64
+	Matchers         []*PromLabelMatcher
+}
+
+type PromReadRequest struct {
+	Queries []*PromQuery
+}
+
+type PromReadResponse struct {
+	Results [][]*PromTimeSeries
+}
+
+func UnmarshalPromReadRequest(b []byte) (req *PromReadRequest, err error) {
+	req = &PromReadRequest{}
+	err = consumeFields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		q := &PromQuery{}
+		req.Queries = append(req.Queries, q)
+		return consumeFields(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+			switch {
+			case num == 1 && typ == protowire.VarintType:
+				x, _ := protowire.ConsumeVarint(v)
+				q.StartTimestampMs = int64(x)
+			case num == 2 && typ == protowire.VarintType:
+				x, _ := protowire.ConsumeVarint(v)
+				q.EndTimestampMs = int64(x)
+			case num == 3 && typ == protowire.BytesType:
+				m := &PromLabelMatcher{}
+				q.Matchers = append(q.Matchers, m)
+				return consumeFields(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+					switch {
+					case num == 1 && typ == protowire.VarintType:
+						x, _ := protowire.ConsumeVarint(v)
+						m.Type = int(x)
+					case num == 2 && typ == protowire.BytesType:
+						m.Name = string(v)
+					case num == 3 && typ == protowire.BytesType:
+						m.Value = string(v)
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+	})
+	return
+}
+
+func (req *PromReadRequest) Marshal() (b []byte) {
+	for _, q := range req.Queries {
+		var qb []byte
+		qb = protowire.AppendTag(qb, 1, protowire.VarintType)
+		qb = protowire.AppendVarint(qb, uint64(q.StartTimestampMs))
+		qb = protowire.AppendTag(qb, 2, protowire.VarintType)
+		qb = protowire.AppendVarint(qb, uint64(q.EndTimestampMs))
+		for _, m := range q.Matchers {
+			var mb []byte
+			mb = protowire.AppendTag(mb, 1, protowire.VarintType)
+			mb = protowire.AppendVarint(mb, uint64(m.Type))
+			mb = protowire.AppendTag(mb, 2, protowire.BytesType)
+			mb = protowire.AppendString(mb, m.Name)
+			mb = protowire.AppendTag(mb, 3, protowire.BytesType)
+			mb = protowire.AppendString(mb, m.Value)
+			qb = protowire.AppendTag(qb, 3, protowire.BytesType)
+			qb = protowire.AppendBytes(qb, mb)
+		}
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, qb)
+	}
+	return
+}
+
+func (rsp *PromReadResponse) Marshal() (b []byte) {
+	for _, result := range rsp.Results {
+		var rb []byte
+		for _, ts := range result {
+			rb = protowire.AppendTag(rb, 1, protowire.BytesType)
+			rb = protowire.AppendBytes(rb, ts.appendProto(nil))
+		}
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, rb)
+	}
+	return
+}
+
+func UnmarshalPromReadResponse(b []byte) (rsp *PromReadResponse, err error) {
+	rsp = &PromReadResponse{}
+	err = consumeFields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		wr, err := UnmarshalPromWriteRequest(v)
+		if err != nil {
+			return err
+		}
+		rsp.Results = append(rsp.Results, wr.Timeseries)
+		return nil
+	})
+	return
+}
@@ -2,6 +2,7 @@ package backend
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -24,14 +25,25 @@ var (
 )
 
 type Proxy struct {
-	Circles []*Circle
-	DBSet   util.Set
+	Circles        []*Circle
+	DBSet          util.Set
+	Cache          *QueryCache
+	Tracker        *QueryTracker
+	balancer       Balancer
+	readStrategy   string
+	hedger         *Hedger
+	guard          *QueryGuard
+	queryTimeout   time.Duration
+	dbQueryTimeout map[string]time.Duration
 }
 
 func NewProxy(cfg *ProxyConfig) (ip *Proxy) {
 	ip = &Proxy{
-		Circles: make([]*Circle, len(cfg.Circles)),
-		DBSet:   util.NewSet(),
+		Circles:        make([]*Circle, len(cfg.Circles)),
+		DBSet:          util.NewSet(),
+		Tracker:        NewQueryTracker(),
+		queryTimeout:   time.Duration(cfg.QueryTimeout) * time.Second,
+		dbQueryTimeout: make(map[string]time.Duration, len(cfg.DBQueryTimeout)),
 	}
 	for idx, circfg := range cfg.Circles {
 		ip.Circles[idx] = NewCircle(circfg, cfg, idx)
@@ -39,6 +51,25 @@ func NewProxy(cfg *ProxyConfig) (ip *Proxy) {
 	for _, db := range cfg.DBList {
 		ip.DBSet.Add(db)
 	}
+	for db, timeout := range cfg.DBQueryTimeout {
+		ip.dbQueryTimeout[db] = time.Duration(timeout) * time.Second
+	}
+	if cfg.QueryCache != nil && cfg.QueryCache.Enable {
+		ip.Cache = NewQueryCache(cfg.QueryCache)
+	}
+	balancer, err := NewBalancer(cfg.ReadStrategy, cfg.Zone)
+	if err != nil {
+		log.Printf("%s, fall back to %s", err, StrategyRandom)
+		balancer = &RandomBalancer{}
+	}
+	ip.balancer = balancer
+	ip.readStrategy = cfg.ReadStrategy
+	if cfg.Hedge != nil && cfg.Hedge.Enable {
+		ip.hedger = NewHedger(cfg.Hedge)
+	}
+	if cfg.QueryGuard != nil && cfg.QueryGuard.Enable {
+		ip.guard = NewQueryGuard(cfg.QueryGuard)
+	}
 	rand.Seed(time.Now().Unix())
 	return
 }
@@ -69,10 +100,14 @@ func (ip *Proxy) GetHealth() []map[string]interface{} {
 			defer wg.Done()
 			health[i] = map[string]interface{}{
 				"circle": map[string]interface{}{
-					"id":         c.CircleId,
-					"name":       c.Name,
-					"active":     c.CheckActive(),
-					"write_only": c.WriteOnly,
+					"id":          c.CircleId,
+					"name":        c.Name,
+					"zone":        c.Zone,
+					"weight":      c.Weight,
+					"active":      c.CheckActive(),
+					"write_only":  c.WriteOnly,
+					"outstanding": c.GetOutstanding(),
+					"latency_ms":  c.GetLatency().Seconds() * 1000,
 				},
 				"backends": c.GetHealth(),
 			}
@@ -82,6 +117,34 @@ func (ip *Proxy) GetHealth() []map[string]interface{} {
 	return health
 }
 
+// readableCircles returns the circles which are not write only, in the order of read strategy
+func (ip *Proxy) readableCircles() []*Circle {
+	circles := ip.nonWriteOnlyCircles()
+	if len(circles) == 0 {
+		return circles
+	}
+	return ip.balancer.Order(circles)
+}
+
+// peekReadableCircles returns the readable circles in the likely order of read strategy, the balancer isn't changed
+func (ip *Proxy) peekReadableCircles() []*Circle {
+	circles := ip.nonWriteOnlyCircles()
+	if len(circles) == 0 || ip.balancer == nil {
+		return circles
+	}
+	return ip.balancer.Peek(circles)
+}
+
+func (ip *Proxy) nonWriteOnlyCircles() []*Circle {
+	circles := make([]*Circle, 0, len(ip.Circles))
+	for _, c := range ip.Circles {
+		if !c.WriteOnly {
+			circles = append(circles, c)
+		}
+	}
+	return circles
+}
+
 func (ip *Proxy) optimalCircle() (c *Circle) {
 	actives := make([]int, len(ip.Circles))
 	for i, c := range ip.Circles {
@@ -98,6 +161,13 @@ func (ip *Proxy) optimalCircle() (c *Circle) {
 	return
 }
 
+func (ip *Proxy) getQueryTimeout(db string) time.Duration {
+	if timeout, ok := ip.dbQueryTimeout[db]; ok {
+		return timeout
+	}
+	return ip.queryTimeout
+}
+
 func (ip *Proxy) Query(w http.ResponseWriter, req *http.Request) (body []byte, err error) {
 	q := strings.TrimSpace(req.FormValue("q"))
 	if q == "" {
@@ -110,73 +180,134 @@ func (ip *Proxy) Query(w http.ResponseWriter, req *http.Request) (body []byte, e
 	}
 
 	checkDb, showDb, alterDb, db := CheckDatabaseFromTokens(tokens)
+	broadcast := CheckBroadcastFromTokens(tokens)
 	if !checkDb {
 		db = req.FormValue("db")
-		if db == "" {
+		if db == "" || broadcast {
 			db, _ = GetDatabaseFromTokens(tokens)
 		}
 	}
 	if !showDb {
-		if db == "" {
+		if db == "" && !broadcast {
 			return nil, ErrDatabaseNotFound
 		}
-		if len(ip.DBSet) > 0 && !ip.DBSet[db] {
+		if db != "" && len(ip.DBSet) > 0 && !ip.DBSet[db] {
 			return nil, fmt.Errorf("database forbidden: %s", db)
 		}
 	}
 
+	// backend requests are canceled when the client disconnects or the query timeout exceeds
+	if timeout := ip.getQueryTimeout(db); timeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+
+	// in-flight queries are tracked for listing and killing
+	ctx, running, untrack := ip.Tracker.Track(req.Context(), db, RedactPassword(q), req.RemoteAddr)
+	defer untrack()
+	defer func() {
+		if err != nil && running.Killed() {
+			err = ErrQueryKilled
+		}
+	}()
+	req = req.WithContext(ctx)
+
+	switch GetHeadStmtFromTokens(tokens, 2) {
+	case "show queries":
+		// all circles -> all backends -> show queries
+		return ip.showQueries(w, req)
+	case "kill query":
+		// backend of query id -> kill query
+		return ip.killQuery(w, req, tokens)
+	}
+
+	explain, analyze, selectTokens := CheckExplainFromTokens(tokens)
 	selectOrShow := CheckSelectOrShowFromTokens(tokens)
-	if selectOrShow && from {
+	// guard policies are checked before any backend is contacted
+	var maxRows int
+	if ip.guard != nil && (selectOrShow || analyze) {
+		policy := ip.guard.Policy(db)
+		if strings.ToLower(selectTokens[0]) == "select" {
+			gq, err := ip.guardQuery(policy, q, tokens, db)
+			if err != nil {
+				return nil, err
+			}
+			if gq != q {
+				q = gq
+				tokens = ScanTokens(q, 0)
+				_, _, selectTokens = CheckExplainFromTokens(tokens)
+				req.Form.Set("q", q)
+			}
+		}
+		if maxRows = policy.MaxRows; maxRows > 0 {
+			req = req.WithContext(WithMaxRows(req.Context(), maxRows))
+		}
+	}
+
+	if explain {
+		// available circle -> backend by key(db,meas), or all backends if regex -> explain
+		return ip.explainQuery(w, req, selectTokens, db)
+	} else if CheckSelectIntoFromTokens(tokens) {
+		// available circle -> backend by key(db,meas) -> select, then write into all circles
+		return ip.selectInto(w, req, tokens, db)
+	} else if selectOrShow && from {
 		// available circle -> backend by key(db,meas) -> select or show
 		meas, err := GetMeasurementFromTokens(tokens)
 		if err != nil {
 			return nil, ErrGetMeasurement
 		}
 		key := GetKey(db, meas)
-		badSet := make(map[int]bool)
-		for {
-			if len(badSet) == len(ip.Circles) {
-				return nil, ErrBackendsUnavailable
-			}
-			id := rand.Intn(len(ip.Circles))
-			if badSet[id] {
-				continue
+		var cacheKey string
+		var cacheGen uint64
+		cacheable := ip.Cache != nil && meas[0] != '/'
+		if cacheable {
+			cacheKey, cacheable = ip.Cache.Key(req, tokens, db)
+		}
+		if cacheable {
+			if header, body, ok := ip.Cache.Get(cacheKey); ok {
+				CopyHeader(w.Header(), header)
+				return body, nil
 			}
-			circle := ip.Circles[id]
-			if circle.WriteOnly {
-				badSet[id] = true
-				continue
+			cacheGen = ip.Cache.Generation(db, meas)
+		}
+		// backend responds json for truncating, the negotiated format is applied after truncated
+		contentType := GetContentType(req)
+		if maxRows > 0 {
+			req.Header.Set("Accept", ContentTypeJSON)
+		}
+		var qr *QueryResult
+		circles := ip.readableCircles()
+		if ip.hedger != nil && strings.ToLower(tokens[0]) == "select" && len(circles) > 1 {
+			qr = ip.queryHedged(circles, key, req)
+			if qr != nil && qr.Header != nil {
+				CopyHeader(w.Header(), qr.Header)
 			}
-			be := circle.GetBackend(key)
-			if be.IsActive() {
-				qr := be.Query(req, w, false)
-				if qr.Status > 0 || len(badSet) == len(ip.Circles)-1 {
-					return qr.Body, qr.Err
-				}
+		} else {
+			qr = ip.queryCircles(circles, key, req, w)
+		}
+		if qr == nil {
+			return nil, ErrBackendsUnavailable
+		}
+		if maxRows > 0 && qr.Err == nil && qr.Status == http.StatusOK {
+			if err = limitBody(qr, contentType, req.FormValue("pretty") == "true", maxRows); err != nil {
+				return nil, err
 			}
-			badSet[id] = true
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Del("Content-Length")
 		}
+		if cacheable && qr.Err == nil && qr.Status == http.StatusOK {
+			ip.Cache.Set(cacheKey, db, meas, cacheGen, qr)
+		}
+		return qr.Body, qr.Err
 	} else if selectOrShow && !from {
 		// available circle -> all backends -> show
-		badSet := make(map[int]bool)
-		for {
-			if len(badSet) == len(ip.Circles) {
-				return ip.optimalCircle().Query(w, req, tokens)
-			}
-			id := rand.Intn(len(ip.Circles))
-			if badSet[id] {
-				continue
-			}
-			circle := ip.Circles[id]
-			if circle.WriteOnly {
-				badSet[id] = true
-				continue
-			}
+		for _, circle := range ip.readableCircles() {
 			if circle.CheckActive() {
 				return circle.Query(w, req, tokens)
 			}
-			badSet[id] = true
 		}
+		return ip.optimalCircle().Query(w, req, tokens)
 	} else if CheckDeleteOrDropMeasurementFromTokens(tokens) {
 		// all circles -> backend by key(db,meas) -> delete or drop
 		meas, err := GetMeasurementFromTokens(tokens)
@@ -193,32 +324,34 @@ func (ip *Proxy) Query(w http.ResponseWriter, req *http.Request) (body []byte, e
 				return nil, fmt.Errorf("backend %s(%s) unavailable", be.Name, be.Url)
 			}
 		}
+		recordRoute(req.Context(), nil, backends...)
 		bodies, _, err := QueryInParallel(backends, req, w, false)
 		if err != nil {
 			return nil, err
 		}
 		return bodies[0], nil
-	} else if alterDb {
-		// all circles -> all backends -> create or drop database
-		for _, circle := range ip.Circles {
-			if !circle.CheckActive() {
-				return nil, fmt.Errorf("circle %d unavailable", circle.CircleId)
+	} else if alterDb || broadcast {
+		// all circles -> all backends -> create or drop database, retention policy, continuous query and user
+		return ip.broadcastQuery(req, w)
+	}
+	return nil, ErrIllegalQL
+}
+
+// queryCircles tries the backend by key in circles one by one, until a backend answers
+func (ip *Proxy) queryCircles(circles []*Circle, key string, req *http.Request, w http.ResponseWriter) *QueryResult {
+	for i, circle := range circles {
+		be := circle.GetBackend(key)
+		if be.IsActive() {
+			qr := circle.QueryBackend(be, req, w)
+			if qr.Status > 0 || i == len(circles)-1 || req.Context().Err() != nil {
+				return qr
 			}
 		}
-		backends := make([]*Backend, 0)
-		for _, circle := range ip.Circles {
-			backends = append(backends, circle.Backends...)
-		}
-		bodies, _, err := QueryInParallel(backends, req, w, false)
-		if err != nil {
-			return nil, err
-		}
-		return bodies[0], nil
 	}
-	return nil, ErrIllegalQL
+	return nil
 }
 
-func (ip *Proxy) Write(p []byte, db, precision string) (err error) {
+func (ip *Proxy) Write(p []byte, db, rp, precision string) (err error) {
 	buf := bytes.NewBuffer(p)
 	var line []byte
 	for {
@@ -233,12 +366,12 @@ func (ip *Proxy) Write(p []byte, db, precision string) (err error) {
 		if len(line) == 0 {
 			break
 		}
-		ip.WriteRow(line, db, precision)
+		ip.WriteRow(line, db, rp, precision)
 	}
 	return
 }
 
-func (ip *Proxy) WriteRow(line []byte, db, precision string) {
+func (ip *Proxy) WriteRow(line []byte, db, rp, precision string) {
 	nanoLine := AppendNano(line, precision)
 	meas, err := ScanKey(nanoLine)
 	if err != nil {
@@ -256,7 +389,10 @@ func (ip *Proxy) WriteRow(line []byte, db, precision string) {
 		log.Printf("write data error: can't get backends")
 		return
 	}
-	point := &LinePoint{db, nanoLine}
+	if ip.Cache != nil {
+		ip.Cache.Invalidate(db, meas)
+	}
+	point := &LinePoint{db, rp, nanoLine}
 	for _, be := range backends {
 		err := be.WritePoint(point)
 		if err != nil {
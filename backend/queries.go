@@ -0,0 +1,208 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RedTimeDB/RedTimeProxy/util"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+var (
+	ErrQueryKilled    = errors.New("query killed")
+	ErrInvalidQueryID = errors.New(`invalid query id, require '<backend>:<qid>' or <qid> ON "<backend>"`)
+)
+
+// RunningQuery is an in-flight query of proxy
+type RunningQuery struct {
+	ID       uint64 `json:"id"`
+	Db       string `json:"db"`
+	Query    string `json:"query"`
+	Client   string `json:"client"`
+	Duration string `json:"duration"`
+	start    time.Time
+	cancel   context.CancelFunc
+	killed   int32
+}
+
+func (rq *RunningQuery) Killed() bool {
+	return atomic.LoadInt32(&rq.killed) == 1
+}
+
+// QueryTracker tracks the in-flight queries of proxy, so they can be listed and canceled
+type QueryTracker struct {
+	next    uint64
+	queries sync.Map
+}
+
+func NewQueryTracker() *QueryTracker {
+	return &QueryTracker{}
+}
+
+// Track registers the query, and returns a cancelable context of query and a function to unregister it
+func (qt *QueryTracker) Track(ctx context.Context, db, q, client string) (context.Context, *RunningQuery, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	rq := &RunningQuery{
+		ID:     atomic.AddUint64(&qt.next, 1),
+		Db:     db,
+		Query:  q,
+		Client: client,
+		start:  time.Now(),
+		cancel: cancel,
+	}
+	qt.queries.Store(rq.ID, rq)
+	return ctx, rq, func() {
+		qt.queries.Delete(rq.ID)
+		cancel()
+	}
+}
+
+// List returns the in-flight queries ordered by id
+func (qt *QueryTracker) List() []*RunningQuery {
+	queries := make([]*RunningQuery, 0)
+	qt.queries.Range(func(_, v interface{}) bool {
+		rq := *v.(*RunningQuery)
+		rq.Duration = time.Since(rq.start).Truncate(time.Millisecond).String()
+		queries = append(queries, &rq)
+		return true
+	})
+	sort.Slice(queries, func(i, j int) bool { return queries[i].ID < queries[j].ID })
+	return queries
+}
+
+// Kill cancels the in-flight query, it returns false if the query isn't found
+func (qt *QueryTracker) Kill(id uint64) bool {
+	v, ok := qt.queries.Load(id)
+	if !ok {
+		return false
+	}
+	rq := v.(*RunningQuery)
+	atomic.StoreInt32(&rq.killed, 1)
+	rq.cancel()
+	return true
+}
+
+// showQueries lists the running queries of all backends, the qid column is <backend>:<qid> accepted by kill query,
+// and the host column is the backend running the query. The failures of backends are reported as warning messages.
+func (ip *Proxy) showQueries(w http.ResponseWriter, req *http.Request) (body []byte, err error) {
+	backends := ip.allBackends()
+	recordRoute(req.Context(), nil, backends...)
+	contentType := GetContentType(req)
+	qrs, inactive := queryBackends(backends, NewQueryRequest("GET", "", "show queries").WithContext(req.Context()))
+
+	row := &models.Row{Columns: []string{"qid", "query", "database", "duration", "status", "host"}}
+	result := &Result{Series: models.Rows{row}}
+	for _, qr := range qrs {
+		if qr.Err == nil {
+			qr.Err = statementError(qr.Body)
+		}
+		var series models.Rows
+		if qr.Err == nil {
+			series, qr.Err = SeriesWithNumbers(qr.Body)
+		}
+		if qr.Err != nil {
+			result.Messages = append(result.Messages, &Message{Level: "warning", Text: fmt.Sprintf("backend %s: %s", qr.Backend, qr.Err)})
+			continue
+		}
+		for _, s := range series {
+			for _, v := range s.Values {
+				if len(v) == 0 {
+					continue
+				}
+				v[0] = fmt.Sprintf("%s:%v", qr.Backend, v[0])
+				row.Values = append(row.Values, append(v, qr.Backend))
+			}
+		}
+	}
+	rsp := ResponseFromResults([]*Result{result})
+	if inactive > 0 {
+		rsp.Err = fmt.Sprintf("%d/%d backends unavailable", inactive, len(backends))
+	}
+	w.Header().Set("Content-Type", contentType)
+	return MarshalResponse(rsp, contentType, req.FormValue("pretty") == "true"), nil
+}
+
+// queryBackends queries the active backends in parallel, unlike QueryResultsInParallel it waits for all of them,
+// so the failure of one backend doesn't hide the results of the others, the results are ordered by backend name
+func queryBackends(backends []*Backend, req *http.Request) (qrs []*QueryResult, inactive int) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, be := range backends {
+		if !be.IsActive() {
+			inactive++
+			continue
+		}
+		wg.Add(1)
+		go func(be *Backend) {
+			defer wg.Done()
+			qr := be.Query(CloneQueryRequest(req), nil, true)
+			qr.Backend = be.Name
+			mu.Lock()
+			qrs = append(qrs, qr)
+			mu.Unlock()
+		}(be)
+	}
+	wg.Wait()
+	sort.Slice(qrs, func(i, j int) bool { return qrs[i].Backend < qrs[j].Backend })
+	return
+}
+
+// killQuery routes the kill query statement to the backend of ON clause
+func (ip *Proxy) killQuery(w http.ResponseWriter, req *http.Request, tokens []string) (body []byte, err error) {
+	name, qid, err := parseQueryID(tokens)
+	if err != nil {
+		return nil, err
+	}
+	for _, be := range ip.allBackends() {
+		if be.Name != name {
+			continue
+		}
+		if !be.IsActive() {
+			return nil, fmt.Errorf("backend %s(%s) unavailable", be.Name, be.Url)
+		}
+		recordRoute(req.Context(), nil, be)
+		qr := be.Query(NewQueryRequest("POST", "", "kill query "+qid).WithContext(req.Context()), nil, true)
+		if qr.Err == nil {
+			qr.Err = statementError(qr.Body)
+		}
+		if qr.Err != nil {
+			return nil, qr.Err
+		}
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		return qr.Body, nil
+	}
+	return nil, fmt.Errorf("backend not found: %s", name)
+}
+
+// parseQueryID parses the statement KILL QUERY '<backend>:<qid>', the qid column of show queries,
+// or KILL QUERY <qid> ON "<backend>", qid is an integer literal, and backend is the host column of show queries
+func parseQueryID(tokens []string) (name, qid string, err error) {
+	switch {
+	case len(tokens) == 3 && len(tokens[2]) >= 2 && (tokens[2][0] == '\'' || tokens[2][0] == '"') && tokens[2][len(tokens[2])-1] == tokens[2][0]:
+		id := tokens[2][1 : len(tokens[2])-1]
+		i := strings.LastIndexByte(id, ':')
+		if i < 0 {
+			return "", "", ErrInvalidQueryID
+		}
+		name, qid = id[:i], id[i+1:]
+	case len(tokens) == 5 && strings.ToLower(tokens[3]) == "on":
+		name, qid = tokens[4], tokens[2]
+		if len(name) >= 2 && name[0] == '"' && name[len(name)-1] == '"' {
+			name = util.UnescapeIdentifier(name[1 : len(name)-1])
+		}
+	default:
+		return "", "", ErrInvalidQueryID
+	}
+	if _, err = strconv.ParseUint(qid, 10, 64); err != nil || name == "" {
+		return "", "", ErrInvalidQueryID
+	}
+	return name, qid, nil
+}
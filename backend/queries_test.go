@@ -0,0 +1,66 @@
+package backend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestQueryTracker(t *testing.T) {
+	qt := NewQueryTracker()
+	ctx, rq, untrack := qt.Track(context.Background(), "db", "select * from cpu", "127.0.0.1:1234")
+	if queries := qt.List(); len(queries) != 1 || queries[0].Query != "select * from cpu" {
+		t.Fatalf("query not tracked: %v", queries)
+	}
+	if !qt.Kill(rq.ID) || ctx.Err() == nil || !rq.Killed() {
+		t.Errorf("query not killed")
+	}
+	untrack()
+	if len(qt.List()) != 0 || qt.Kill(rq.ID) {
+		t.Errorf("query not untracked")
+	}
+}
+
+func TestShowAndKillQueries(t *testing.T) {
+	var killed string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get("q")
+		if strings.HasPrefix(q, "kill query") {
+			killed = q
+			w.Write([]byte(`{"results":[{"statement_id":0}]}`))
+			return
+		}
+		w.Write([]byte(`{"results":[{"statement_id":0,"series":[{"columns":["qid","query","database","duration","status"],"values":[[36,"SELECT * FROM cpu","db","10s","running"]]}]}]}`))
+	}))
+	defer server.Close()
+
+	failed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results":[{"statement_id":0,"error":"show queries failed"}]}`))
+	}))
+	defer failed.Close()
+
+	ip := &Proxy{Circles: []*Circle{newTestCircle(0, server.URL), newTestCircle(1, failed.URL)}, Tracker: NewQueryTracker()}
+	req := NewQueryRequest("GET", "", "SHOW QUERIES")
+	req.RemoteAddr = "127.0.0.1:1234"
+	rec := httptest.NewRecorder()
+	body, err := ip.Query(rec, req)
+	if err != nil || !strings.Contains(string(body), `"columns":["qid","query","database","duration","status","host"]`) ||
+		!strings.Contains(string(body), `["`+server.URL+`:36","SELECT * FROM cpu","db","10s","running","`+server.URL+`"]`) ||
+		!strings.Contains(string(body), `{"level":"warning","text":"backend `+failed.URL+`: show queries failed"}`) {
+		t.Fatalf("show queries wrong: %s %v", body, err)
+	}
+
+	for _, q := range []string{`KILL QUERY 36 ON "` + server.URL + `"`, "KILL QUERY '" + server.URL + ":36'"} {
+		killed = ""
+		if _, err = ip.Query(httptest.NewRecorder(), NewQueryRequest("POST", "", q)); err != nil || killed != "kill query 36" {
+			t.Errorf("%s wrong: %q %v", q, killed, err)
+		}
+	}
+	for _, q := range []string{"KILL QUERY 36", "KILL QUERY 'x'", "KILL QUERY '" + server.URL + ":x'", `KILL QUERY '1-2' ON "` + server.URL + `"`, `KILL QUERY -1 ON "` + server.URL + `"`, `KILL QUERY 36 FROM "` + server.URL + `"`} {
+		if _, err = ip.Query(httptest.NewRecorder(), NewQueryRequest("POST", "", q)); err != ErrInvalidQueryID {
+			t.Errorf("%s should fail: %v", q, err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/RedTimeDB/RedTimeProxy/util"
+)
+
+type queryRouteKey struct{}
+
+// QueryRoute collects the circles and backends which a query is routed to
+type QueryRoute struct {
+	circles  []string
+	backends []string
+	lock     sync.Mutex
+}
+
+// WithQueryRoute returns a context collecting the routes of query
+func WithQueryRoute(ctx context.Context, route *QueryRoute) context.Context {
+	return context.WithValue(ctx, queryRouteKey{}, route)
+}
+
+// recordRoute records the circle and backends to the route of query, circle can be nil
+func recordRoute(ctx context.Context, circle *Circle, backends ...*Backend) {
+	route, ok := ctx.Value(queryRouteKey{}).(*QueryRoute)
+	if !ok {
+		return
+	}
+	route.lock.Lock()
+	defer route.lock.Unlock()
+	if circle != nil {
+		route.circles = appendUnique(route.circles, circle.Name)
+	}
+	for _, be := range backends {
+		route.backends = appendUnique(route.backends, be.Name)
+	}
+}
+
+func appendUnique(s []string, v string) []string {
+	for _, e := range s {
+		if e == v {
+			return s
+		}
+	}
+	return append(s, v)
+}
+
+func (route *QueryRoute) Circles() []string {
+	route.lock.Lock()
+	defer route.lock.Unlock()
+	return append([]string(nil), route.circles...)
+}
+
+func (route *QueryRoute) Backends() []string {
+	route.lock.Lock()
+	defer route.lock.Unlock()
+	return append([]string(nil), route.backends...)
+}
+
+// QueryLogEntry is a line of query log
+type QueryLogEntry struct {
+	Time      string   `json:"time"`
+	User      string   `json:"user,omitempty"`
+	Client    string   `json:"client"`
+	Db        string   `json:"db,omitempty"`
+	Statement string   `json:"statement"`
+	Circle    string   `json:"circle,omitempty"`
+	Backends  []string `json:"backends,omitempty"`
+	Duration  float64  `json:"duration_ms"`
+	Bytes     int      `json:"bytes"`
+	Err       string   `json:"error,omitempty"`
+}
+
+// QueryLogger writes the queries slower than threshold as rotating json lines
+type QueryLogger struct {
+	out  io.Writer
+	slow time.Duration
+}
+
+func NewQueryLogger(cfg *QueryLogConfig) *QueryLogger {
+	util.MakeDir(filepath.Dir(cfg.Path))
+	return &QueryLogger{
+		out: &lumberjack.Logger{
+			Filename:   cfg.Path,
+			MaxSize:    cfg.MaxSize,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     cfg.MaxAge,
+		},
+		slow: time.Duration(cfg.SlowThreshold) * time.Millisecond,
+	}
+}
+
+// Log writes the entry if the query took at least the slow threshold
+func (ql *QueryLogger) Log(entry *QueryLogEntry, start time.Time, route *QueryRoute) {
+	duration := time.Since(start)
+	if duration < ql.slow {
+		return
+	}
+	entry.Time = start.UTC().Format(time.RFC3339Nano)
+	entry.Duration = float64(duration) / float64(time.Millisecond)
+	if route != nil {
+		entry.Circle = strings.Join(route.Circles(), ",")
+		entry.Backends = route.Backends()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	ql.out.Write(append(line, '\n'))
+}
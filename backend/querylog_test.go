@@ -0,0 +1,48 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "querylog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log", "query.log")
+
+	route := &QueryRoute{}
+	ctx := WithQueryRoute(context.Background(), route)
+	circle := newTestCircle(0, "http://127.0.0.1:8086")
+	circle.Name = "circle-1"
+	recordRoute(ctx, circle, circle.Backends...)
+	recordRoute(ctx, circle, circle.Backends[0])
+
+	ql := NewQueryLogger(&QueryLogConfig{Path: path, SlowThreshold: 1000, MaxSize: 1})
+	ql.Log(&QueryLogEntry{Client: "127.0.0.1:1234", Db: "db", Statement: "select * from fast"}, time.Now(), route)
+	ql.Log(&QueryLogEntry{User: "admin", Client: "127.0.0.1:1234", Db: "db", Statement: "select * from slow", Bytes: 10}, time.Now().Add(-2*time.Second), route)
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("only slow query should be logged: %s", b)
+	}
+	entry := &QueryLogEntry{}
+	if err = json.Unmarshal([]byte(lines[0]), entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Statement != "select * from slow" || entry.User != "admin" || entry.Duration < 2000 || entry.Circle != circle.Name || len(entry.Backends) != len(circle.Backends) {
+		t.Errorf("wrong entry: %s", lines[0])
+	}
+}
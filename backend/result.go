@@ -53,6 +53,34 @@ func ResponseFromResponseBytes(b []byte) (rsp *Response, e error) {
 	return
 }
 
+// numberJSON keeps the numbers as json.Number, so that integers beyond 2^53 are encoded back exactly
+var numberJSON = jsoniter.Config{UseNumber: true}.Froze()
+
+// SeriesWithNumbers is like SeriesFromResponseBytes, but the numbers are json.Number
+func SeriesWithNumbers(b []byte) (series models.Rows, e error) {
+	results, e := ResultsWithNumbers(b)
+	if e == nil && len(results) > 0 {
+		series = results[0].Series
+	}
+	return
+}
+
+// ResultsWithNumbers is like ResultsFromResponseBytes, but the numbers are json.Number
+func ResultsWithNumbers(b []byte) (results []*Result, e error) {
+	rsp, e := ResponseWithNumbers(b)
+	if e == nil {
+		results = rsp.Results
+	}
+	return
+}
+
+// ResponseWithNumbers is like ResponseFromResponseBytes, but the numbers are json.Number
+func ResponseWithNumbers(b []byte) (rsp *Response, e error) {
+	rsp = &Response{}
+	e = numberJSON.Unmarshal(b, rsp)
+	return
+}
+
 func ResponseFromSeries(series models.Rows) (rsp *Response) {
 	r := &Result{
 		Series: series,
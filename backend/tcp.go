@@ -0,0 +1,93 @@
+package backend
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// HandshakePrefix starts the optional first line of a tcp connection, like "#! db=mydb rp=autogen precision=s",
+// it's a comment of line protocol
+const HandshakePrefix = "#!"
+
+var ErrInvalidPrecision = errors.New("invalid precision, require ns, n, u, ms, s, m or h")
+
+var precisions = map[string]bool{"ns": true, "n": true, "u": true, "ms": true, "s": true, "m": true, "h": true}
+
+// LineTarget is the db, rp and precision of the lines of a connection
+type LineTarget struct {
+	Db        string
+	Rp        string
+	Precision string
+}
+
+// ParseHandshake overrides the target by the handshake line "#! key=value ...", keys are db, rp and precision
+func ParseHandshake(line string, target *LineTarget) error {
+	if !strings.HasPrefix(line, HandshakePrefix) {
+		return fmt.Errorf("invalid handshake: %q", line)
+	}
+	for _, kv := range strings.Fields(line[len(HandshakePrefix):]) {
+		idx := strings.IndexByte(kv, '=')
+		if idx <= 0 {
+			return fmt.Errorf("invalid handshake option: %q, require key=value", kv)
+		}
+		key, value := kv[:idx], kv[idx+1:]
+		switch key {
+		case "db":
+			target.Db = value
+		case "rp":
+			target.Rp = value
+		case "precision":
+			if !precisions[value] {
+				return ErrInvalidPrecision
+			}
+			target.Precision = value
+		default:
+			return fmt.Errorf("unknown handshake option: %q", key)
+		}
+	}
+	return nil
+}
+
+// LineBatcher batches lines, and flushes them once the batch is full or Flush is called
+type LineBatcher struct {
+	buf   bytes.Buffer
+	lines int
+	size  int
+	flush func(p []byte)
+	lock  sync.Mutex
+}
+
+func NewLineBatcher(size int, flush func(p []byte)) *LineBatcher {
+	return &LineBatcher{size: size, flush: flush}
+}
+
+func (lb *LineBatcher) Add(line []byte) {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	lb.buf.Write(line)
+	lb.buf.WriteByte('\n')
+	lb.lines++
+	if lb.lines >= lb.size {
+		lb.flushLocked()
+	}
+}
+
+func (lb *LineBatcher) Flush() {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	lb.flushLocked()
+}
+
+func (lb *LineBatcher) flushLocked() {
+	if lb.lines == 0 {
+		return
+	}
+	p := make([]byte, lb.buf.Len())
+	copy(p, lb.buf.Bytes())
+	lb.buf.Reset()
+	lb.lines = 0
+	lb.flush(p)
+}
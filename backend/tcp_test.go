@@ -0,0 +1,37 @@
+package backend
+
+import (
+	"testing"
+)
+
+func TestParseHandshake(t *testing.T) {
+	target := &LineTarget{Db: "db", Precision: "ns"}
+	if err := ParseHandshake("#! db=mydb rp=weekly precision=s", target); err != nil || *target != (LineTarget{"mydb", "weekly", "s"}) {
+		t.Errorf("handshake parsed wrong: %+v %v", target, err)
+	}
+	target = &LineTarget{Db: "db", Rp: "autogen", Precision: "ns"}
+	if err := ParseHandshake("#! precision=ms", target); err != nil || *target != (LineTarget{"db", "autogen", "ms"}) {
+		t.Errorf("handshake parsed wrong: %+v %v", target, err)
+	}
+	for _, line := range []string{"# db=mydb", "#! db", "#! precision=us", "#! user=root"} {
+		if err := ParseHandshake(line, &LineTarget{}); err == nil {
+			t.Errorf("handshake %q should fail", line)
+		}
+	}
+}
+
+func TestLineBatcher(t *testing.T) {
+	var batches []string
+	lb := NewLineBatcher(2, func(p []byte) { batches = append(batches, string(p)) })
+	lb.Add([]byte("cpu value=1"))
+	if len(batches) != 0 {
+		t.Fatalf("batch flushed before full: %q", batches)
+	}
+	lb.Add([]byte("cpu value=2"))
+	lb.Add([]byte("cpu value=3"))
+	lb.Flush()
+	lb.Flush()
+	if len(batches) != 2 || batches[0] != "cpu value=1\ncpu value=2\n" || batches[1] != "cpu value=3\n" {
+		t.Errorf("batches wrong: %q", batches)
+	}
+}
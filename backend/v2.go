@@ -0,0 +1,52 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrBucketNotFound = errors.New("bucket not found")
+
+// MapBucket returns the db and rp of a v2 bucket, by the configured mapping or else the convention db/rp,
+// an empty rp means the default retention policy
+func MapBucket(buckets map[string]*BucketConfig, bucket string) (db, rp string, err error) {
+	if bc, ok := buckets[bucket]; ok {
+		return bc.Database, bc.RetentionPolicy, nil
+	}
+	db, rp = bucket, ""
+	if idx := strings.IndexByte(bucket, '/'); idx >= 0 {
+		db, rp = bucket[:idx], bucket[idx+1:]
+	}
+	if db == "" {
+		return "", "", ErrBucketNotFound
+	}
+	return db, rp, nil
+}
+
+// HealthCheck is the health of proxy in the shape of influxdb 2.x, the health of circles can be attached
+type HealthCheck struct {
+	Name    string                   `json:"name"`
+	Message string                   `json:"message,omitempty"`
+	Status  string                   `json:"status"`
+	Checks  []*HealthCheck           `json:"checks,omitempty"`
+	Version string                   `json:"version,omitempty"`
+	Circles []map[string]interface{} `json:"circles,omitempty"`
+}
+
+// GetHealthCheck returns pass if any readable circle has all backends active, each circle is a check
+func (ip *Proxy) GetHealthCheck() *HealthCheck {
+	hc := &HealthCheck{Name: "redtimeproxy", Status: "fail", Message: "no circle available for queries", Version: Version}
+	for _, c := range ip.Circles {
+		active := c.GetActiveCount()
+		check := &HealthCheck{Name: c.Name, Status: "fail", Message: fmt.Sprintf("%d/%d backends active", active, len(c.Backends))}
+		if active == len(c.Backends) {
+			check.Status = "pass"
+			if !c.WriteOnly {
+				hc.Status, hc.Message = "pass", "ready for queries and writes"
+			}
+		}
+		hc.Checks = append(hc.Checks, check)
+	}
+	return hc
+}
@@ -0,0 +1,42 @@
+package backend
+
+import (
+	"testing"
+)
+
+func TestMapBucket(t *testing.T) {
+	buckets := map[string]*BucketConfig{"telegraf": {Database: "metrics", RetentionPolicy: "weekly"}}
+	tests := []struct {
+		bucket string
+		db     string
+		rp     string
+		err    error
+	}{
+		{"telegraf", "metrics", "weekly", nil},
+		{"db", "db", "", nil},
+		{"db/autogen", "db", "autogen", nil},
+		{"db/", "db", "", nil},
+		{"/autogen", "", "", ErrBucketNotFound},
+		{"", "", "", ErrBucketNotFound},
+	}
+	for _, tt := range tests {
+		db, rp, err := MapBucket(buckets, tt.bucket)
+		if db != tt.db || rp != tt.rp || err != tt.err {
+			t.Errorf("bucket %q mapped wrong: %s %s %v", tt.bucket, db, rp, err)
+		}
+	}
+}
+
+func TestGetHealthCheck(t *testing.T) {
+	c1, c2 := newTestCircle(0, "http://127.0.0.1:1"), newTestCircle(1, "http://127.0.0.1:2")
+	c1.Name, c2.Name, c2.WriteOnly = "circle-1", "circle-2", true
+	ip := &Proxy{Circles: []*Circle{c1, c2}}
+	if hc := ip.GetHealthCheck(); hc.Status != "pass" || len(hc.Checks) != 2 || hc.Version != Version {
+		t.Errorf("health check wrong: %+v", hc)
+	}
+	c1.Backends[0].SetActive(false)
+	hc := ip.GetHealthCheck()
+	if hc.Status != "fail" || hc.Checks[0].Status != "fail" || hc.Checks[0].Message != "0/1 backends active" || hc.Checks[1].Status != "pass" {
+		t.Errorf("health check wrong with inactive circle: %+v", hc)
+	}
+}
@@ -59,19 +59,48 @@ func main() {
 		log.Fatalln("create data dir error")
 		return
 	}
-	//判断是够开启UDP-Server
-	if cfg.UDPEnable {
-		//开启UDP
-		go func() {
+	// all services share the proxy, so that backends, buffer files and query cache aren't duplicated
+	ip := backend.NewProxy(cfg)
+	//开启UDP
+	for _, us := range service.NewUDPServices(ip, cfg) {
+		go func(us *service.UDPService) {
 			defer func() {
 				if r := recover(); r != nil {
 					log.Println("UDP Server recover", r)
 				}
 			}()
-			err := service.NewUDPService(cfg).ListenAndServe()
+			err := us.ListenAndServe()
 			if err != nil {
 				log.Println(err)
 			}
+		}(us)
+	}
+
+	if cfg.Graphite != nil && cfg.Graphite.Enable {
+		go func() {
+			gs, err := service.NewGraphiteService(ip, cfg)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			if err = gs.ListenAndServe(); err != nil {
+				log.Println(err)
+			}
+		}()
+	}
+
+	if cfg.OpenTSDB != nil && cfg.OpenTSDB.Enable {
+		go func() {
+			if err := service.NewOpenTSDBService(ip, cfg).ListenAndServe(); err != nil {
+				log.Println(err)
+			}
+		}()
+	}
+
+	if cfg.TCP != nil && cfg.TCP.Enable {
+		go func() {
+			if err := service.NewTCPService(ip, cfg).ListenAndServe(); err != nil {
+				log.Println(err)
+			}
 		}()
 	}
 
@@ -86,7 +115,7 @@ func main() {
 	//判断是否开启MQTT监听
 	if cfg.MQTTEnable {
 		go func() {
-			col, err := service.NewMQTTService(cfg)
+			col, err := service.NewMQTTService(ip, cfg)
 			if err != nil {
 				log.Fatalln(err)
 			}
@@ -105,7 +134,7 @@ func main() {
 		Recorder: metrics.NewRecorder(metrics.Config{}),
 	})
 	mux := http.NewServeMux()
-	service.NewHTTPService(cfg).Register(mux)
+	service.NewHTTPService(ip, cfg).Register(mux)
 	server := &http.Server{
 		Addr:        cfg.ListenAddr,
 		Handler:     mux,
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/RedTimeDB/RedTimeProxy/backend"
+)
+
+// GraphiteService is graphite plaintext server of tcp and udp
+type GraphiteService struct {
+	ip           *backend.Proxy
+	parser       *backend.GraphiteParser
+	cfg          *backend.GraphiteConfig
+	WriteTracing bool
+	Count        uint64
+}
+
+// NewGraphiteService is create graphite server object, ip is shared with the other services
+func NewGraphiteService(ip *backend.Proxy, cfg *backend.ProxyConfig) (gs *GraphiteService, err error) {
+	parser, err := backend.NewGraphiteParser(cfg.Graphite.Separator, cfg.Graphite.Templates, cfg.Graphite.Tags)
+	if err != nil {
+		return
+	}
+	gs = &GraphiteService{
+		ip:           ip,
+		parser:       parser,
+		cfg:          cfg.Graphite,
+		WriteTracing: cfg.WriteTracing,
+	}
+	return
+}
+
+// ListenAndServe listens on tcp, udp or both, and blocks until a listener fails
+func (gs *GraphiteService) ListenAndServe() (err error) {
+	errc := make(chan error, 2)
+	if gs.cfg.Protocol == "tcp" || gs.cfg.Protocol == "both" {
+		ln, err := net.Listen("tcp", gs.cfg.BindAddr)
+		if err != nil {
+			return err
+		}
+		defer ln.Close()
+		go func() { errc <- gs.serveTCP(ln) }()
+	}
+	if gs.cfg.Protocol == "udp" || gs.cfg.Protocol == "both" {
+		pc, err := net.ListenPacket("udp", gs.cfg.BindAddr)
+		if err != nil {
+			return err
+		}
+		defer pc.Close()
+		go func() { errc <- gs.serveUDP(pc) }()
+	}
+	log.Printf("graphite service start on DB [%s], listen %s %s", gs.cfg.Database, gs.cfg.Protocol, gs.cfg.BindAddr)
+	return <-errc
+}
+
+func (gs *GraphiteService) serveTCP(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go gs.handleConn(conn)
+	}
+}
+
+func (gs *GraphiteService) handleConn(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		gs.handleLine(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("graphite tcp read error: %s, client: %s", err, conn.RemoteAddr())
+	}
+}
+
+func (gs *GraphiteService) serveUDP(pc net.PacketConn) error {
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return err
+		}
+		for _, line := range bytes.Split(buf[:n], []byte("\n")) {
+			gs.handleLine(string(line))
+		}
+	}
+}
+
+func (gs *GraphiteService) handleLine(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	atomic.AddUint64(&gs.Count, 1)
+	p, err := gs.parser.Parse(line, time.Now())
+	if err != nil {
+		log.Printf("graphite parse error: %s, line: %s", err, line)
+		return
+	}
+	if gs.WriteTracing {
+		log.Printf("graphite write: [%s %s]\n", gs.cfg.Database, p)
+	}
+	if err = gs.ip.Write(p, gs.cfg.Database, gs.cfg.RetentionPolicy, "ns"); err != nil {
+		log.Println(err)
+	}
+}
@@ -36,12 +36,14 @@ type HttpService struct { // nolint:golint
 	AuthSecure   bool
 	WriteTracing bool
 	QueryTracing bool
+	queryLog     *backend.QueryLogger
+	prom         *backend.PrometheusConfig
+	v2           *backend.V2Config
 	count        uint64
 }
 
-// NewHTTPService is create http server object
-func NewHTTPService(cfg *backend.ProxyConfig) (hs *HttpService) { // nolint:golint
-	ip := backend.NewProxy(cfg) //create influx proxy object by config
+// NewHTTPService is create http server object, ip is shared with the other services
+func NewHTTPService(ip *backend.Proxy, cfg *backend.ProxyConfig) (hs *HttpService) { // nolint:golint
 	hs = &HttpService{
 		ip:           ip,
 		tx:           transfer.NewTransfer(cfg, ip.Circles),
@@ -50,6 +52,11 @@ func NewHTTPService(cfg *backend.ProxyConfig) (hs *HttpService) { // nolint:goli
 		AuthSecure:   cfg.AuthSecure,
 		WriteTracing: cfg.WriteTracing,
 		QueryTracing: cfg.QueryTracing,
+		prom:         cfg.Prometheus,
+		v2:           cfg.V2,
+	}
+	if cfg.QueryLog != nil && cfg.QueryLog.Enable {
+		hs.queryLog = backend.NewQueryLogger(cfg.QueryLog)
 	}
 	//go hs.Count()
 	return
@@ -60,14 +67,21 @@ func (hs *HttpService) Register(mux *http.ServeMux) {
 	mux.HandleFunc("/ping", hs.handlerPing)
 	mux.HandleFunc("/query", hs.handlerQuery)
 	mux.HandleFunc("/write", hs.handlerWrite)
+	mux.HandleFunc("/api/v1/prom/write", hs.handlerPromWrite)
+	mux.HandleFunc("/api/v1/prom/read", hs.handlerPromRead)
+	mux.HandleFunc("/api/v2/write", hs.handlerV2Write)
+	mux.HandleFunc("/api/v2/query", hs.handlerV2Query)
 	mux.HandleFunc("/health", hs.handlerHealth)
 	mux.HandleFunc("/replica", hs.handlerReplica)
+	mux.HandleFunc("/route", hs.handlerRoute)
 	mux.HandleFunc("/encrypt", hs.handlerEncrypt)
 	mux.HandleFunc("/decrypt", hs.handlerDencrypt)
 	mux.HandleFunc("/rebalance", hs.handlerRebalance)
 	mux.HandleFunc("/recovery", hs.handlerRecovery)
 	mux.HandleFunc("/resync", hs.handlerResync)
 	mux.HandleFunc("/cleanup", hs.handlerCleanup)
+	mux.HandleFunc("/reconcile", hs.handlerReconcile)
+	mux.HandleFunc("/queries", hs.handlerQueries)
 	mux.HandleFunc("/transfer/state", hs.handlerTransferState)
 	mux.HandleFunc("/transfer/stats", hs.handlerTransferStats)
 	mux.HandleFunc("/debug/pprof/", pprof.Index)
@@ -86,19 +100,50 @@ func (hs *HttpService) handlerQuery(w http.ResponseWriter, req *http.Request) {
 	}
 
 	db := req.FormValue("db")
-	q := req.FormValue("q")
+	// passwords of create user and set password are redacted from the logs
+	q := backend.RedactPassword(req.FormValue("q"))
+	contentType := backend.GetContentType(req)
+	var entry *backend.QueryLogEntry
+	if hs.queryLog != nil {
+		entry = &backend.QueryLogEntry{User: queryUser(req), Client: req.RemoteAddr, Db: db, Statement: q}
+		route := &backend.QueryRoute{}
+		req = req.WithContext(backend.WithQueryRoute(req.Context(), route))
+		defer hs.queryLog.Log(entry, time.Now(), route)
+	}
 	body, err := hs.ip.Query(w, req)
 	if err != nil {
 		log.Printf("query error: %s, query: %s %s %s, client: %s", err, req.Method, db, q, req.RemoteAddr)
-		hs.writeError(w, req, 400, err.Error())
+		if entry != nil {
+			entry.Err = err.Error()
+		}
+		hs.writeQueryError(w, req, contentType, 400, err.Error())
 		return
 	}
+	if entry != nil {
+		entry.Bytes = len(body)
+	}
 	hs.writeBody(w, body)
 	if hs.QueryTracing {
 		log.Printf("query: %s %s %s, client: %s", req.Method, db, q, req.RemoteAddr)
 	}
 }
 
+func queryUser(req *http.Request) string {
+	if u := req.URL.Query().Get("u"); u != "" {
+		return u
+	}
+	if u, _, ok := req.BasicAuth(); ok {
+		return u
+	}
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Token ") {
+		token := strings.TrimPrefix(auth, "Token ")
+		if idx := strings.IndexByte(token, ':'); idx >= 0 {
+			return token[:idx]
+		}
+	}
+	return ""
+}
+
 func (hs *HttpService) handlerWrite(w http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
 	atomic.AddUint64(&hs.count, 1)
@@ -136,7 +181,7 @@ func (hs *HttpService) handlerWrite(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	err = hs.ip.Write(p, db, precision)
+	err = hs.ip.Write(p, db, "", precision)
 	if err == nil {
 		hs.WriteHeader(w, 204)
 	}
@@ -150,6 +195,10 @@ func (hs *HttpService) handlerHealth(w http.ResponseWriter, req *http.Request) {
 	if !hs.checkMethodAndAuth(w, req, "GET") {
 		return
 	}
+	if wantsV2Health(req) {
+		hs.writeV2Health(w, req)
+		return
+	}
 	hs.Write(w, req, 200, hs.ip.GetHealth())
 }
 
@@ -178,6 +227,33 @@ func (hs *HttpService) handlerReplica(w http.ResponseWriter, req *http.Request)
 	}
 }
 
+func (hs *HttpService) handlerRoute(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	if !hs.checkMethodAndAuth(w, req, "GET", "POST") {
+		return
+	}
+
+	db := req.URL.Query().Get("db")
+	if q := req.URL.Query().Get("q"); q != "" {
+		hs.Write(w, req, 200, hs.ip.RouteQuery(strings.TrimSpace(q), db, req.URL.Query().Get("rp")))
+		return
+	}
+	if req.Method != "POST" || db == "" {
+		hs.writeError(w, req, 400, "require q, or db with line protocol body")
+		return
+	}
+	precision := req.URL.Query().Get("precision")
+	if precision == "" {
+		precision = "ns"
+	}
+	p, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		hs.writeError(w, req, 400, err.Error())
+		return
+	}
+	hs.Write(w, req, 200, hs.ip.RouteLines(p, db, precision))
+}
+
 func (hs *HttpService) handlerEncrypt(w http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
 	if !hs.checkMethod(w, req, "GET") {
@@ -365,6 +441,44 @@ func (hs *HttpService) handlerCleanup(w http.ResponseWriter, req *http.Request)
 	hs.writeText(w, 202, "accepted")
 }
 
+func (hs *HttpService) handlerReconcile(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	if !hs.checkMethodAndAuth(w, req, "POST") {
+		return
+	}
+
+	backendUrls := hs.formValues(req, "backend_urls")
+	dbs := hs.formValues(req, "dbs")
+	actions, err := hs.ip.Reconcile(dbs, backendUrls)
+	if err != nil {
+		hs.writeError(w, req, 400, err.Error())
+		return
+	}
+	hs.Write(w, req, 200, actions)
+}
+
+func (hs *HttpService) handlerQueries(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	if !hs.checkMethodAndAuth(w, req, "GET", "POST") {
+		return
+	}
+
+	if req.Method == "GET" {
+		hs.Write(w, req, 200, hs.ip.Tracker.List())
+		return
+	}
+	id, err := strconv.ParseUint(req.FormValue("id"), 10, 64)
+	if err != nil {
+		hs.writeError(w, req, 400, "invalid id, require positive integer")
+		return
+	}
+	if !hs.ip.Tracker.Kill(id) {
+		hs.writeError(w, req, 404, fmt.Sprintf("query %d not found", id))
+		return
+	}
+	hs.writeText(w, 200, "killed")
+}
+
 func (hs *HttpService) handlerTransferState(w http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
 	if !hs.checkMethodAndAuth(w, req, "GET", "POST") {
@@ -463,6 +577,18 @@ func (hs *HttpService) writeError(w http.ResponseWriter, req *http.Request, stat
 	w.Write(util.MarshalJSON(rsp, pretty))
 }
 
+func (hs *HttpService) writeQueryError(w http.ResponseWriter, req *http.Request, contentType string, status int, err string) {
+	if contentType == backend.ContentTypeJSON {
+		hs.writeError(w, req, status, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Influxdb-Error", err)
+	hs.WriteHeader(w, status)
+	rsp := backend.ResponseFromError(err)
+	w.Write(backend.MarshalResponse(rsp, contentType, false))
+}
+
 func (hs *HttpService) writeBody(w http.ResponseWriter, body []byte) {
 	hs.WriteHeader(w, 200)
 	w.Write(body)
@@ -504,6 +630,13 @@ func (hs *HttpService) checkAuth(w http.ResponseWriter, req *http.Request) bool
 	if ok && hs.transAuth(u) == hs.Username && hs.transAuth(p) == hs.Password {
 		return true
 	}
+	// the token of v2 api is username:password, the same as influxdb 1.8
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Token ") {
+		token := strings.TrimPrefix(auth, "Token ")
+		if idx := strings.IndexByte(token, ':'); idx >= 0 && hs.transAuth(token[:idx]) == hs.Username && hs.transAuth(token[idx+1:]) == hs.Password {
+			return true
+		}
+	}
 	hs.writeError(w, req, 401, "authentication failed")
 	return false
 }
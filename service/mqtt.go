@@ -1,15 +1,14 @@
 package service
 
 import (
-	"encoding/json"
 	"errors"
-	"fmt"
 	"log"
 	"net/url"
 	"time"
 
 	paho "github.com/eclipse/paho.mqtt.golang"
-	"github.com/influxdata/influxdb1-client/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	uuid "github.com/satori/go.uuid"
 
 	"github.com/RedTimeDB/RedTimeProxy/backend"
@@ -21,24 +20,46 @@ var (
 	ErrEmptyDB   = errors.New("db cannot find in db list")
 )
 
+var (
+	mqttReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "redtimeproxy_mqtt_messages_received_total",
+		Help: "The total number of messages received by mqtt subscription",
+	}, []string{"subscription"})
+	mqttParseFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "redtimeproxy_mqtt_messages_parse_failed_total",
+		Help: "The total number of messages dropped by mqtt subscription for invalid payload",
+	}, []string{"subscription"})
+)
+
 type MQTTService struct {
-	ip        *backend.Proxy
-	tx        *transfer.Transfer
-	mqtt      paho.Client
-	db        string
-	precision string
+	ip   *backend.Proxy
+	tx   *transfer.Transfer
+	mqtt paho.Client
+	subs []*mqttSubscription
 }
 
-func NewMQTTService(cfg *backend.ProxyConfig) (us *MQTTService, err error) {
-	ip := backend.NewProxy(cfg) //create influx proxy object by config
+// mqttSubscription is the subscription config with its payload parser
+type mqttSubscription struct {
+	*backend.MQTTSubscription
+	parser *backend.MQTTParser
+}
+
+func NewMQTTService(ip *backend.Proxy, cfg *backend.ProxyConfig) (us *MQTTService, err error) {
 	if cfg.MQTT == nil {
 		err = ErrEmptyMQTT
 		return
 	}
-	db := cfg.MQTT.Db
-	if len(ip.DBSet) > 0 && !ip.DBSet[db] {
-		err = ErrEmptyDB
-		return
+	subs := make([]*mqttSubscription, 0, len(cfg.MQTT.Subscriptions))
+	for _, sub := range cfg.MQTT.Subscriptions {
+		if len(ip.DBSet) > 0 && !ip.DBSet[sub.Db] {
+			err = ErrEmptyDB
+			return
+		}
+		parser, err := backend.NewMQTTParser(sub)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, &mqttSubscription{MQTTSubscription: sub, parser: parser})
 	}
 	u, err := url.Parse(cfg.MQTT.Server)
 	if err != nil {
@@ -58,16 +79,11 @@ func NewMQTTService(cfg *backend.ProxyConfig) (us *MQTTService, err error) {
 	if err := check(mqtt.Connect()); err != nil {
 		return nil, err
 	}
-	precision := cfg.MQTT.Precision
-	if precision == "" {
-		precision = "ns"
-	}
 	us = &MQTTService{
-		ip:        ip,
-		tx:        transfer.NewTransfer(cfg, ip.Circles),
-		mqtt:      mqtt,
-		precision: precision,
-		db:        db,
+		ip:   ip,
+		tx:   transfer.NewTransfer(cfg, ip.Circles),
+		mqtt: mqtt,
+		subs: subs,
 	}
 	return
 }
@@ -87,43 +103,44 @@ func check(t paho.Token) error {
 }
 
 type Message struct {
-	Topic string
-	Value interface{}
-	Time  time.Time
+	Topic   string
+	Payload []byte
+	Time    time.Time
+	sub     *mqttSubscription
 }
 
+// Collect subscribes the topic filters with their qos, messages of all subscriptions are sent to the channel
 func (c *MQTTService) Collect() <-chan Message {
 	messages := make(chan Message)
 
-	const allMessages = "#"
-	if err := check(c.mqtt.Subscribe(allMessages, 0, func(c paho.Client, m paho.Message) {
-		j := map[string]interface{}{}
-		if err := json.Unmarshal(m.Payload(), &j); err == nil {
+	for _, sub := range c.subs {
+		sub := sub
+		if err := check(c.mqtt.Subscribe(sub.Topic, sub.QoS, func(c paho.Client, m paho.Message) {
+			mqttReceived.WithLabelValues(sub.Topic).Inc()
 			messages <- Message{
-				Topic: m.Topic(),
-				Value: j,
-				Time:  time.Now(),
+				Topic:   m.Topic(),
+				Payload: m.Payload(),
+				Time:    time.Now(),
+				sub:     sub,
 			}
-		} else {
-			log.Printf("Payload parsing error: %s, Payload: %v", err.Error(), m.Payload())
+		})); err != nil {
+			log.Println(err)
 		}
-	})); err != nil {
-		log.Println(err)
 	}
 	return messages
 }
 
+// WriteMQTT parses the payload by the format of its subscription, and writes the points to the db of subscription
 func (c *MQTTService) WriteMQTT(msg Message) {
-	pt, _ := models.NewPoint(msg.Topic,
-		models.NewTags(map[string]string{}),
-		msg.Value.(map[string]interface{}),
-		msg.Time)
-	fields, _ := pt.Fields()
-
-	influxmsg := fmt.Sprintf("%s %s %d\n", pt.Key(), string(fields.MarshalBinary()),
-		pt.UnixNano()/models.GetPrecisionMultiplier(c.precision))
+	sub := msg.sub
+	lines, err := sub.parser.Parse(msg.Topic, msg.Payload, msg.Time)
+	if err != nil {
+		mqttParseFailed.WithLabelValues(sub.Topic).Inc()
+		log.Printf("Payload parsing error: %s, topic: %s, Payload: %s", err, msg.Topic, msg.Payload)
+		return
+	}
 
-	err := c.ip.Write([]byte(influxmsg), c.db, c.precision)
+	err = c.ip.Write(lines, sub.Db, sub.RetentionPolicy, sub.Precision)
 	if err != nil {
 		log.Println(err)
 	}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gzip "github.com/klauspost/pgzip"
+
+	"github.com/RedTimeDB/RedTimeProxy/backend"
+	"github.com/RedTimeDB/RedTimeProxy/util"
+)
+
+// peekTimeout is the timeout to read the first bytes of opentsdb connection
+const peekTimeout = 10 * time.Second
+
+// OpenTSDBService is opentsdb server, telnet put lines and http /api/put share the same port
+type OpenTSDBService struct {
+	ip           *backend.Proxy
+	cfg          *backend.OpenTSDBConfig
+	WriteTracing bool
+	Count        uint64
+}
+
+// NewOpenTSDBService is create opentsdb server object, ip is shared with the other services
+func NewOpenTSDBService(ip *backend.Proxy, cfg *backend.ProxyConfig) (ts *OpenTSDBService) {
+	return &OpenTSDBService{
+		ip:           ip,
+		cfg:          cfg.OpenTSDB,
+		WriteTracing: cfg.WriteTracing,
+	}
+}
+
+// ListenAndServe accepts connections, which are served as telnet if they start with "put ", or else as http
+func (ts *OpenTSDBService) ListenAndServe() (err error) {
+	ln, err := net.Listen("tcp", ts.cfg.BindAddr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	log.Printf("opentsdb service start on DB [%s], listen %s", ts.cfg.Database, ts.cfg.BindAddr)
+
+	httpLn := newChanListener(ln.Addr())
+	defer httpLn.Close()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/put", ts.handlerPut)
+	go http.Serve(httpLn, mux)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go func(conn net.Conn) {
+			// the deadline stops idle connections from holding the goroutine before the protocol is known
+			conn.SetReadDeadline(time.Now().Add(peekTimeout))
+			rd := bufio.NewReader(conn)
+			head, err := rd.Peek(4)
+			if err != nil {
+				conn.Close()
+				return
+			}
+			conn.SetReadDeadline(time.Time{})
+			if string(head) == "put " {
+				ts.handleTelnet(conn, rd)
+				return
+			}
+			select {
+			case httpLn.ch <- &peekedConn{Conn: conn, rd: rd}:
+			case <-httpLn.done:
+				conn.Close()
+			}
+		}(conn)
+	}
+}
+
+func (ts *OpenTSDBService) handleTelnet(conn net.Conn, rd *bufio.Reader) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		atomic.AddUint64(&ts.Count, 1)
+		pt, err := backend.ParseOpenTSDBPut(line)
+		if err != nil {
+			log.Printf("opentsdb put error: %s, line: %s", err, line)
+			continue
+		}
+		p, err := pt.Line()
+		if err != nil {
+			log.Printf("opentsdb put error: %s, line: %s", err, line)
+			continue
+		}
+		ts.write(p)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("opentsdb telnet read error: %s, client: %s", err, conn.RemoteAddr())
+	}
+}
+
+// handlerPut writes the data points of /api/put, it returns 204 if all are written, or else 400 with the summary
+func (ts *OpenTSDBService) handlerPut(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	if req.Method != "POST" {
+		w.WriteHeader(405)
+		return
+	}
+	body := req.Body
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		b, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, "unable to decode gzip body", 400)
+			return
+		}
+		defer b.Close()
+		body = b
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	points, err := backend.ParseOpenTSDBJSON(b)
+	if err != nil {
+		http.Error(w, "unable to decode json body: "+err.Error(), 400)
+		return
+	}
+
+	var buf bytes.Buffer
+	var errs []map[string]interface{}
+	for _, pt := range points {
+		atomic.AddUint64(&ts.Count, 1)
+		p, err := pt.Line()
+		if err != nil {
+			errs = append(errs, map[string]interface{}{"datapoint": pt, "error": err.Error()})
+			continue
+		}
+		buf.Write(p)
+		buf.WriteByte('\n')
+	}
+	if buf.Len() > 0 {
+		ts.write(buf.Bytes())
+	}
+	if len(errs) == 0 {
+		w.WriteHeader(204)
+		return
+	}
+	summary := map[string]interface{}{"success": len(points) - len(errs), "failed": len(errs)}
+	if _, ok := req.URL.Query()["details"]; ok {
+		summary["errors"] = errs
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(400)
+	w.Write(util.MarshalJSON(summary, false))
+}
+
+func (ts *OpenTSDBService) write(p []byte) {
+	if ts.WriteTracing {
+		log.Printf("opentsdb write: [%s %s]\n", ts.cfg.Database, p)
+	}
+	if err := ts.ip.Write(p, ts.cfg.Database, ts.cfg.RetentionPolicy, "ns"); err != nil {
+		log.Println(err)
+	}
+}
+
+// chanListener is a listener of the connections handed over by channel
+type chanListener struct {
+	addr net.Addr
+	ch   chan net.Conn
+	done chan struct{}
+	once sync.Once
+}
+
+func newChanListener(addr net.Addr) *chanListener {
+	return &chanListener{addr: addr, ch: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (cl *chanListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-cl.ch:
+		return conn, nil
+	case <-cl.done:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func (cl *chanListener) Close() error {
+	cl.once.Do(func() { close(cl.done) })
+	return nil
+}
+
+func (cl *chanListener) Addr() net.Addr {
+	return cl.addr
+}
+
+// peekedConn is a connection whose peeked bytes are read from the buffered reader first
+type peekedConn struct {
+	net.Conn
+	rd *bufio.Reader
+}
+
+func (pc *peekedConn) Read(b []byte) (int, error) {
+	return pc.rd.Read(b)
+}
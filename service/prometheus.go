@@ -0,0 +1,124 @@
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/snappy"
+
+	"github.com/RedTimeDB/RedTimeProxy/backend"
+)
+
+// promTarget returns the db and rp of prometheus remote storage, query parameters override the configured ones
+func (hs *HttpService) promTarget(req *http.Request) (db, rp string) {
+	if hs.prom != nil {
+		db, rp = hs.prom.Database, hs.prom.RetentionPolicy
+	}
+	if v := req.URL.Query().Get("db"); v != "" {
+		db = v
+	}
+	if v := req.URL.Query().Get("rp"); v != "" {
+		rp = v
+	}
+	return
+}
+
+func (hs *HttpService) handlerPromWrite(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	atomic.AddUint64(&hs.count, 1)
+	if !hs.checkMethodAndAuth(w, req, "POST") {
+		return
+	}
+
+	db, rp := hs.promTarget(req)
+	if db == "" {
+		hs.writeError(w, req, 400, "database not found")
+		return
+	}
+	if len(hs.ip.DBSet) > 0 && !hs.ip.DBSet[db] {
+		hs.writeError(w, req, 400, fmt.Sprintf("database forbidden: %s", db))
+		return
+	}
+
+	compressed, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		hs.writeError(w, req, 400, err.Error())
+		return
+	}
+	b, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		hs.writeError(w, req, 400, "unable to decode snappy body")
+		return
+	}
+	wr, err := backend.UnmarshalPromWriteRequest(b)
+	if err != nil {
+		hs.writeError(w, req, 400, err.Error())
+		return
+	}
+	p, dropped, err := backend.PromWriteRequestToLines(wr)
+	if err != nil {
+		hs.writeError(w, req, 400, err.Error())
+		return
+	}
+	if dropped > 0 {
+		log.Printf("prometheus write: %d samples of NaN or Inf dropped, db: %s, client: %s", dropped, db, req.RemoteAddr)
+	}
+
+	err = hs.ip.Write(p, db, rp, "ns")
+	if err == nil {
+		hs.WriteHeader(w, 204)
+	}
+	if hs.WriteTracing {
+		log.Printf("prometheus write: %s %s %s, client: %s", db, rp, p, req.RemoteAddr)
+	}
+}
+
+func (hs *HttpService) handlerPromRead(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	atomic.AddUint64(&hs.count, 1)
+	if !hs.checkMethodAndAuth(w, req, "POST") {
+		return
+	}
+
+	db, rp := hs.promTarget(req)
+	if db == "" {
+		hs.writeError(w, req, 400, "database not found")
+		return
+	}
+	if len(hs.ip.DBSet) > 0 && !hs.ip.DBSet[db] {
+		hs.writeError(w, req, 400, fmt.Sprintf("database forbidden: %s", db))
+		return
+	}
+
+	compressed, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		hs.writeError(w, req, 400, err.Error())
+		return
+	}
+	b, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		hs.writeError(w, req, 400, "unable to decode snappy body")
+		return
+	}
+	rr, err := backend.UnmarshalPromReadRequest(b)
+	if err != nil {
+		hs.writeError(w, req, 400, err.Error())
+		return
+	}
+
+	rsp, err := hs.ip.ReadPrometheus(req, rr, db, rp)
+	if err != nil {
+		hs.writeError(w, req, 400, err.Error())
+		log.Printf("prometheus read error: %s, db: %s, client: %s", err, db, req.RemoteAddr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Header().Set("Content-Encoding", "snappy")
+	hs.writeBody(w, snappy.Encode(nil, rsp.Marshal()))
+	if hs.QueryTracing {
+		log.Printf("prometheus read: %s %s %d queries, client: %s", db, rp, len(rr.Queries), req.RemoteAddr)
+	}
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/RedTimeDB/RedTimeProxy/backend"
+)
+
+// maxLineSize is the max size of a line protocol line of tcp connection
+const maxLineSize = 4 * 1024 * 1024
+
+// TCPService is tcp server of newline-delimited line protocol
+type TCPService struct {
+	ip           *backend.Proxy
+	cfg          *backend.TCPConfig
+	WriteTracing bool
+	conns        chan struct{}
+	Count        uint64
+}
+
+// NewTCPService is create tcp server object, ip is shared with the other services
+func NewTCPService(ip *backend.Proxy, cfg *backend.ProxyConfig) *TCPService {
+	ts := &TCPService{
+		ip:           ip,
+		cfg:          cfg.TCP,
+		WriteTracing: cfg.WriteTracing,
+	}
+	if cfg.TCP.MaxConnections > 0 {
+		ts.conns = make(chan struct{}, cfg.TCP.MaxConnections)
+	}
+	return ts
+}
+
+// ListenAndServe listens on tcp, or tls if enabled
+func (ts *TCPService) ListenAndServe() (err error) {
+	ln, err := net.Listen("tcp", ts.cfg.BindAddr)
+	if err != nil {
+		return err
+	}
+	if ts.cfg.TLSEnabled {
+		cert, err := tls.LoadX509KeyPair(ts.cfg.TLSCert, ts.cfg.TLSKey)
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		ln = tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{cert}})
+	}
+	defer ln.Close()
+	log.Printf("tcp service start on DB [%s], listen %s, tls %t", ts.cfg.Database, ts.cfg.BindAddr, ts.cfg.TLSEnabled)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		if ts.conns != nil {
+			select {
+			case ts.conns <- struct{}{}:
+			default:
+				log.Printf("tcp connection limit %d reached, client: %s", ts.cfg.MaxConnections, conn.RemoteAddr())
+				conn.Close()
+				continue
+			}
+		}
+		go ts.handleConn(conn)
+	}
+}
+
+// handleConn reads lines until the connection is closed or idle, the first line can be a handshake of db, rp and precision
+func (ts *TCPService) handleConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		if ts.conns != nil {
+			<-ts.conns
+		}
+	}()
+
+	target := &backend.LineTarget{Db: ts.cfg.Database, Rp: ts.cfg.RetentionPolicy, Precision: ts.cfg.Precision}
+	batcher := backend.NewLineBatcher(ts.cfg.BatchSize, func(p []byte) {
+		if ts.WriteTracing {
+			log.Printf("tcp write: [%s %s %s %s]\n", target.Db, target.Rp, target.Precision, p)
+		}
+		if err := ts.ip.Write(p, target.Db, target.Rp, target.Precision); err != nil {
+			log.Println(err)
+		}
+	})
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		batcher.Flush()
+	}()
+	go func() {
+		ticker := time.NewTicker(time.Duration(ts.cfg.BatchTimeout) * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				batcher.Flush()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	idle := time.Duration(ts.cfg.IdleTimeout) * time.Second
+	first := true
+	for conn.SetReadDeadline(time.Now().Add(idle)) == nil && scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if first && bytes.HasPrefix(line, []byte(backend.HandshakePrefix)) {
+			if err := backend.ParseHandshake(string(line), target); err != nil {
+				log.Printf("tcp handshake error: %s, client: %s", err, conn.RemoteAddr())
+				return
+			}
+		}
+		if first {
+			first = false
+			if !ts.checkTarget(conn, target) {
+				return
+			}
+		}
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		atomic.AddUint64(&ts.Count, 1)
+		batcher.Add(line)
+	}
+	if err := scanner.Err(); err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			log.Printf("tcp connection idle timeout, client: %s", conn.RemoteAddr())
+			return
+		}
+		log.Printf("tcp read error: %s, client: %s", err, conn.RemoteAddr())
+	}
+}
+
+func (ts *TCPService) checkTarget(conn net.Conn, target *backend.LineTarget) bool {
+	if target.Db == "" {
+		log.Printf("tcp database not found, client: %s", conn.RemoteAddr())
+		return false
+	}
+	if len(ts.ip.DBSet) > 0 && !ts.ip.DBSet[target.Db] {
+		log.Printf("tcp database forbidden: %s, client: %s", target.Db, conn.RemoteAddr())
+		return false
+	}
+	return true
+}
@@ -1,90 +1,186 @@
 package service
 
 import (
-	"github.com/panjf2000/ants/v2"
-	"github.com/RedTimeDB/RedTimeProxy/backend"
-	"github.com/RedTimeDB/RedTimeProxy/transfer"
+	"bytes"
 	"log"
 	"net"
+	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/RedTimeDB/RedTimeProxy/backend"
+)
+
+var (
+	udpReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "redtimeproxy_udp_packets_received_total",
+		Help: "The total number of packets received by udp listener",
+	}, []string{"bind"})
+	udpOversized = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "redtimeproxy_udp_packets_oversized_total",
+		Help: "The total number of packets dropped by udp listener for exceeding max datagram size",
+	}, []string{"bind"})
+	udpParseFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "redtimeproxy_udp_packets_parse_failed_total",
+		Help: "The total number of packets with invalid lines received by udp listener",
+	}, []string{"bind"})
+	udpDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "redtimeproxy_udp_packets_dropped_total",
+		Help: "The total number of packets dropped by udp listener for full queue",
+	}, []string{"bind"})
 )
 
 // UDPService is UDP server
 type UDPService struct {
 	ip           *backend.Proxy
-	tx           *transfer.Transfer
+	cfg          *backend.UDPConfig
+	batcher      *backend.LineBatcher
+	buffers      *backend.Pool
+	queue        chan []byte
 	WriteTracing bool
-	UDPBind      string // UDP监控地址
-	UDPDatabase  string // UDP数据库
-	UDPPoolSize  int
-	UDPPrecision string
 	Count        uint64
 }
 
+// NewUDPServices creates the enabled udp listeners, which share the proxy ip
+func NewUDPServices(ip *backend.Proxy, cfg *backend.ProxyConfig) (services []*UDPService) {
+	for _, udp := range cfg.UDP {
+		if !udp.Enable {
+			continue
+		}
+		services = append(services, NewUDPService(ip, udp, cfg))
+	}
+	return
+}
+
 // NewUDPService is create udp server object
-func NewUDPService(cfg *backend.ProxyConfig) (us *UDPService) { // nolint:golint
-	ip := backend.NewProxy(cfg) //create influx proxy object by config
+func NewUDPService(ip *backend.Proxy, udp *backend.UDPConfig, cfg *backend.ProxyConfig) (us *UDPService) { // nolint:golint
 	us = &UDPService{
-		ip:           ip,
-		tx:           transfer.NewTransfer(cfg, ip.Circles),
-		UDPBind:      cfg.UDPBind,
-		UDPDatabase:  cfg.UDPDataBase,
+		ip:  ip,
+		cfg: udp,
+		// one more byte than max datagram size to detect the larger datagrams
+		buffers:      backend.NewPool(udp.QueueSize, udp.MaxDatagramSize+1),
+		queue:        make(chan []byte, udp.QueueSize),
 		WriteTracing: cfg.WriteTracing,
-		UDPPoolSize:  cfg.UDPPoolSize,
-		UDPPrecision: cfg.UDPPrecision,
 	}
+	us.batcher = backend.NewLineBatcher(udp.BatchSize, us.write)
 	//go us.count()
 	return
 }
 
-// ListenAndServe is UDP server Bind Handle
-
-// TODO 可以参考 backend.NewBackend 的 方式，创建一个协程池出来
+// ListenAndServe listens on udp and serves the datagrams
 func (us *UDPService) ListenAndServe() (err error) {
-	pc, err := net.ListenPacket("udp", us.UDPBind)
-
+	conn, err := net.ListenPacket("udp", us.cfg.BindAddr)
 	if err != nil {
 		return err
 	}
-	defer pc.Close()
-	log.Printf("UDP service start on DB [%s], listen %s", us.UDPDatabase, us.UDPBind)
+	defer conn.Close()
+	if us.cfg.ReadBuffer > 0 {
+		if err = conn.(*net.UDPConn).SetReadBuffer(us.cfg.ReadBuffer); err != nil {
+			return err
+		}
+	}
+	log.Printf("UDP service start on DB [%s], listen %s", us.cfg.Database, us.cfg.BindAddr)
+	return us.serve(conn)
+}
 
-	// 获取 一个 指定大小的 缓冲池
-	poolBuffer := backend.NewPool(2048, 2048)
-	// 开始创建 一个 协诚池
-	pool, err := ants.NewPool(us.UDPPoolSize)
-	if err != nil {
-		log.Printf("udp poll err: %s", err)
-		return err
+// serve receives datagrams into the queue, which are parsed and batched by workers,
+// datagrams are dropped if the queue is full so the receive loop never blocks,
+// it returns once the connection fails with a non-temporary error, like being closed,
+// after the queued datagrams are processed and the batch is flushed
+func (us *UDPService) serve(conn net.PacketConn) error {
+	var wg sync.WaitGroup
+	for i := 0; i < us.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			us.worker()
+		}()
 	}
-	defer pool.Release()
+	done := make(chan struct{})
+	go us.flushLoop(done)
+	defer func() {
+		close(us.queue)
+		wg.Wait()
+		close(done)
+		us.batcher.Flush()
+	}()
+
+	bind := us.cfg.BindAddr
 	for {
-		//buf := make([]byte, 1024)
-		buf := poolBuffer.Get()
-		// TODO 调用 ReadFrom 方法接收到数据后，处理数据花费时间太长，再次调用 ReadFrom，两次调用间隔里，发过来的包可能丢失。 通过将接收到数据存入一个缓冲区，并迅速返回继续 ReadFrom
-		//n, addr, err := pc.ReadFrom(buf)
-		n, _, err := pc.ReadFrom(buf)
+		buf := us.buffers.Get()
+		n, _, err := conn.ReadFrom(buf)
 		if err != nil {
-			log.Println(err)
-			poolBuffer.Put(buf) // 如果错误 就归还
+			us.buffers.Put(buf)
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				log.Println(err)
+				continue
+			}
+			return err
+		}
+		udpReceived.WithLabelValues(bind).Inc()
+		if n > us.cfg.MaxDatagramSize {
+			udpOversized.WithLabelValues(bind).Inc()
+			us.buffers.Put(buf)
 			continue
 		}
-		ants.Submit(func() {
-			us.process(poolBuffer, buf[:n])
-		})
+		select {
+		case us.queue <- buf[:n]:
+		default:
+			udpDropped.WithLabelValues(bind).Inc()
+			us.buffers.Put(buf)
+		}
+	}
+}
+
+func (us *UDPService) worker() {
+	for buf := range us.queue {
+		us.process(buf)
+		us.buffers.Put(buf)
 	}
-	return
 }
 
-// process 进程执行
-func (us *UDPService) process(pool *backend.Pool, buf []byte) {
+// process adds the valid lines of datagram to batch
+func (us *UDPService) process(buf []byte) {
 	atomic.AddUint64(&us.Count, 1)
-	defer pool.Put(buf) // 正常执行后 释放 已占用的
+	failed := false
+	for _, line := range bytes.Split(buf, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		if !backend.CheckLine(line, us.cfg.Precision) {
+			failed = true
+			continue
+		}
+		us.batcher.Add(line)
+	}
+	if failed {
+		udpParseFailed.WithLabelValues(us.cfg.BindAddr).Inc()
+	}
+}
+
+// flushLoop writes the batch every batch timeout, even if it isn't full, until done is closed
+func (us *UDPService) flushLoop(done <-chan struct{}) {
+	ticker := time.NewTicker(time.Duration(us.cfg.BatchTimeout) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			us.batcher.Flush()
+		case <-done:
+			return
+		}
+	}
+}
+
+func (us *UDPService) write(p []byte) {
 	if us.WriteTracing {
-		log.Printf("write: [%s %s]\n", us.UDPDatabase, buf)
+		log.Printf("write: [%s %s]\n", us.cfg.Database, p)
 	}
-	err := us.ip.Write(buf, us.UDPDatabase, us.UDPPrecision)
+	err := us.ip.Write(p, us.cfg.Database, us.cfg.RetentionPolicy, us.cfg.Precision)
 	if err != nil {
 		log.Println(err)
 	}
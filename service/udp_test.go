@@ -0,0 +1,96 @@
+package service
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RedTimeDB/RedTimeProxy/backend"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newTestUDPService(t *testing.T, workers, queueSize int) (*UDPService, net.PacketConn, chan error, chan string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	udp := &backend.UDPConfig{
+		BindAddr:        conn.LocalAddr().String(),
+		Database:        "db",
+		Precision:       "ns",
+		Workers:         workers,
+		QueueSize:       queueSize,
+		MaxDatagramSize: 32,
+		BatchSize:       1000,
+		BatchTimeout:    int(time.Hour / time.Millisecond),
+	}
+	us := NewUDPService(nil, udp, &backend.ProxyConfig{})
+	flushed := make(chan string, 10)
+	us.batcher = backend.NewLineBatcher(udp.BatchSize, func(p []byte) { flushed <- string(p) })
+	done := make(chan error, 1)
+	go func() { done <- us.serve(conn) }()
+	return us, conn, done, flushed
+}
+
+func sendDatagrams(t *testing.T, addr string, datagrams ...string) {
+	client, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for _, d := range datagrams {
+		if _, err = client.Write([]byte(d)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func waitCounter(t *testing.T, name string, c prometheus.Counter, want float64) {
+	deadline := time.Now().Add(2 * time.Second)
+	for testutil.ToFloat64(c) < want && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := testutil.ToFloat64(c); got != want {
+		t.Errorf("%s counter wrong: got %v, want %v", name, got, want)
+	}
+}
+
+func TestUDPServiceCounters(t *testing.T) {
+	us, conn, done, flushed := newTestUDPService(t, 1, 10)
+	bind := us.cfg.BindAddr
+	sendDatagrams(t, bind, "cpu value=1", "cpu,host="+strings.Repeat("a", 32)+" value=1", "cpu value=1\ncpu", "# comment")
+	waitCounter(t, "received", udpReceived.WithLabelValues(bind), 4)
+	waitCounter(t, "oversized", udpOversized.WithLabelValues(bind), 1)
+	waitCounter(t, "parse_failed", udpParseFailed.WithLabelValues(bind), 1)
+	waitCounter(t, "dropped", udpDropped.WithLabelValues(bind), 0)
+
+	conn.Close()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("serve should return the error of closed connection")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("serve should return once the connection is closed")
+	}
+	select {
+	case p := <-flushed:
+		if p != "cpu value=1\ncpu value=1\n" {
+			t.Errorf("pending lines flushed wrong: %q", p)
+		}
+	default:
+		t.Error("pending lines should be flushed once serve returns")
+	}
+}
+
+func TestUDPServiceDropped(t *testing.T) {
+	// no workers drain the queue, so the datagrams beyond queue size are dropped
+	us, conn, _, _ := newTestUDPService(t, 0, 1)
+	defer conn.Close()
+	bind := us.cfg.BindAddr
+	sendDatagrams(t, bind, "cpu value=1", "cpu value=2", "cpu value=3")
+	waitCounter(t, "received", udpReceived.WithLabelValues(bind), 3)
+	waitCounter(t, "dropped", udpDropped.WithLabelValues(bind), 2)
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	gzip "github.com/klauspost/pgzip"
+
+	"github.com/RedTimeDB/RedTimeProxy/backend"
+	"github.com/RedTimeDB/RedTimeProxy/util"
+)
+
+// v2Precisions maps the precisions of v2 api to the ones of v1
+var v2Precisions = map[string]string{"ns": "ns", "us": "u", "ms": "ms", "s": "s"}
+
+// v2Query is the request body of v2 query api, only influxql is supported
+type v2Query struct {
+	Query  string `json:"query"`
+	Type   string `json:"type"`
+	Bucket string `json:"bucket"`
+}
+
+func (hs *HttpService) mapBucket(bucket string) (db, rp string, err error) {
+	var buckets map[string]*backend.BucketConfig
+	if hs.v2 != nil {
+		buckets = hs.v2.Buckets
+	}
+	return backend.MapBucket(buckets, bucket)
+}
+
+func (hs *HttpService) handlerV2Write(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	atomic.AddUint64(&hs.count, 1)
+	if !hs.checkMethodAndAuth(w, req, "POST") {
+		return
+	}
+
+	precision := req.URL.Query().Get("precision")
+	if precision == "" {
+		precision = "ns"
+	}
+	precision, ok := v2Precisions[precision]
+	if !ok {
+		hs.writeV2Error(w, 400, "invalid", "invalid precision, require ns, us, ms or s")
+		return
+	}
+	db, rp, err := hs.mapBucket(req.URL.Query().Get("bucket"))
+	if err != nil {
+		hs.writeV2Error(w, 404, "not found", err.Error())
+		return
+	}
+	if len(hs.ip.DBSet) > 0 && !hs.ip.DBSet[db] {
+		hs.writeV2Error(w, 403, "forbidden", fmt.Sprintf("database forbidden: %s", db))
+		return
+	}
+
+	body := req.Body
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		b, err := gzip.NewReader(body)
+		if err != nil {
+			hs.writeV2Error(w, 400, "invalid", "unable to decode gzip body")
+			return
+		}
+		defer b.Close()
+		body = b
+	}
+	p, err := ioutil.ReadAll(body)
+	if err != nil {
+		hs.writeV2Error(w, 400, "invalid", err.Error())
+		return
+	}
+
+	err = hs.ip.Write(p, db, rp, precision)
+	if err == nil {
+		hs.WriteHeader(w, 204)
+	}
+	if hs.WriteTracing {
+		log.Printf("v2 write: %s %s %s %s, client: %s", db, rp, precision, p, req.RemoteAddr)
+	}
+}
+
+// handlerV2Query accepts the influxql queries of v2 api, and answers them as /query with db and rp of bucket
+func (hs *HttpService) handlerV2Query(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	if !hs.checkMethodAndAuth(w, req, "POST") {
+		return
+	}
+
+	mt, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mt == "application/vnd.flux" {
+		hs.writeV2Error(w, 400, "invalid", "flux query not supported, use influxql")
+		return
+	}
+	var vq v2Query
+	if err := json.NewDecoder(req.Body).Decode(&vq); err != nil {
+		hs.writeV2Error(w, 400, "invalid", "unable to decode query body: "+err.Error())
+		return
+	}
+	if vq.Type != "influxql" {
+		hs.writeV2Error(w, 400, "invalid", "flux query not supported, use influxql")
+		return
+	}
+	if vq.Bucket == "" {
+		vq.Bucket = req.URL.Query().Get("bucket")
+	}
+	form := url.Values{"q": []string{vq.Query}}
+	if vq.Bucket != "" {
+		db, rp, err := hs.mapBucket(vq.Bucket)
+		if err != nil {
+			hs.writeV2Error(w, 404, "not found", err.Error())
+			return
+		}
+		form.Set("db", db)
+		if rp != "" {
+			form.Set("rp", rp)
+		}
+	}
+	req.Form, req.PostForm = form, url.Values{}
+	hs.handlerQuery(w, req)
+}
+
+// wantsV2Health checks if /health is asked in the shape of influxdb 2.x, by query parameter v2=true
+// or Accept application/json like the 2.x client libraries, the other requests get the backends of circles
+func wantsV2Health(req *http.Request) bool {
+	if req.URL.Query().Get("v2") == "true" {
+		return true
+	}
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept)); err == nil && mediaType == "application/json" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeV2Health answers the health in the shape of influxdb 2.x, it's 503 if no circle is ready for queries
+func (hs *HttpService) writeV2Health(w http.ResponseWriter, req *http.Request) {
+	hc := hs.ip.GetHealthCheck()
+	hc.Circles = hs.ip.GetHealth()
+	if hc.Status != "pass" {
+		w.Header().Set("Content-Type", "application/json")
+		hs.WriteHeader(w, 503)
+		w.Write(util.MarshalJSON(hc, req.URL.Query().Get("pretty") == "true"))
+		return
+	}
+	hs.Write(w, req, 200, hc)
+}
+
+func (hs *HttpService) writeV2Error(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Influxdb-Error", message)
+	hs.WriteHeader(w, status)
+	w.Write(util.MarshalJSON(map[string]string{"code": code, "message": message}, false))
+}
@@ -0,0 +1,27 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestWantsV2Health(t *testing.T) {
+	tests := []struct {
+		url    string
+		accept string
+		v2     bool
+	}{
+		{"/health", "", false},
+		{"/health", "*/*", false},
+		{"/health", "application/json", true},
+		{"/health", "text/html, application/json; q=0.9", true},
+		{"/health?v2=true", "", true},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.url, nil)
+		req.Header.Set("Accept", tt.accept)
+		if v2 := wantsV2Health(req); v2 != tt.v2 {
+			t.Errorf("%s with accept %q: got %t, want %t", tt.url, tt.accept, v2, tt.v2)
+		}
+	}
+}
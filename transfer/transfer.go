@@ -20,7 +20,7 @@ import (
 )
 
 var (
-	FieldTypes    = []string{"float", "integer", "string", "boolean"}
+	FieldTypes    = backend.FieldTypes
 	RetryCount    = 10
 	RetryInterval = 15
 	DefaultWorker = 1
@@ -177,33 +177,16 @@ func (tx *Transfer) write(ch chan *QueryResult, dsts []*backend.Backend, db, mea
 		columns := serie.Columns
 		valen := len(serie.Values)
 		for idx, value := range serie.Values {
-			mtagSet := []string{util.EscapeMeasurement(meas)}
-			fieldSet := make([]string, 0)
-			for i := 1; i < len(value); i++ {
-				k := columns[i]
-				v := value[i]
-				if tagMap[k] {
-					if v != nil {
-						mtagSet = append(mtagSet, fmt.Sprintf("%s=%s", util.EscapeTag(k), util.EscapeTag(v.(string))))
-					}
-				} else if vtype, ok := fieldMap[k]; ok {
-					if v != nil {
-						if vtype == "float" || vtype == "boolean" {
-							fieldSet = append(fieldSet, fmt.Sprintf("%s=%v", util.EscapeTag(k), v))
-						} else if vtype == "integer" {
-							fieldSet = append(fieldSet, fmt.Sprintf("%s=%di", util.EscapeTag(k), int(v.(float64))))
-						} else if vtype == "string" {
-							fieldSet = append(fieldSet, fmt.Sprintf("%s=\"%s\"", util.EscapeTag(k), models.EscapeStringField(v.(string))))
-						}
-					}
+			// fields missing from field keys are skipped rather than written with inferred types
+			for i := 1; i < len(value) && i < len(columns); i++ {
+				if _, ok := fieldMap[columns[i]]; !ok && !tagMap[columns[i]] {
+					value[i] = nil
 				}
 			}
-			mtagStr := strings.Join(mtagSet, ",")
-			fieldStr := strings.Join(fieldSet, ",")
-			ts, _ := time.Parse(time.RFC3339Nano, value[0].(string))
-			line := fmt.Sprintf("%s %s %d\n", mtagStr, fieldStr, ts.UnixNano())
-			buf.WriteString(line)
-			if (idx+1)%tx.Batch == 0 || idx+1 == valen {
+			if line, ok := backend.RowLine(meas, nil, columns, value, tagMap, fieldMap); ok {
+				buf.Write(line)
+			}
+			if ((idx+1)%tx.Batch == 0 || idx+1 == valen) && buf.Len() > 0 {
 				p := buf.Bytes()
 				for _, dst := range dsts {
 					dst := dst
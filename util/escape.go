@@ -9,6 +9,7 @@ var (
 	measurementUnescaper = strings.NewReplacer(`\,`, `,`, `\ `, ` `)
 	tagEscaper           = strings.NewReplacer(`,`, `\,`, ` `, `\ `, `=`, `\=`)
 	tagUnescaper         = strings.NewReplacer(`\,`, `,`, `\ `, ` `, `\=`, `=`)
+	stringEscaper        = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
 )
 
 func EscapeIdentifier(in string) string {
@@ -43,3 +44,7 @@ func UnescapeTag(in string) string {
 	}
 	return tagUnescaper.Replace(in)
 }
+
+func EscapeString(in string) string {
+	return stringEscaper.Replace(in)
+}
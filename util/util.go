@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
+	"io/ioutil"
 	"os"
 
 	gzip "github.com/klauspost/pgzip"
@@ -50,6 +51,15 @@ func GzipCompress(b []byte) (cb []byte, err error) {
 	return
 }
 
+func GzipDecompress(cb []byte) (b []byte, err error) {
+	zip, err := gzip.NewReader(bytes.NewReader(cb))
+	if err != nil {
+		return
+	}
+	defer zip.Close()
+	return ioutil.ReadAll(zip)
+}
+
 func MarshalJSON(v interface{}, pretty bool) []byte {
 	var res []byte
 	if pretty {